@@ -0,0 +1,45 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"sync"
+	"time"
+
+	ui "github.com/gizak/termui"
+)
+
+// maxAlerts is the number of alerts listed in the alerts panel.
+const maxAlerts = 6
+
+// alertsPanel lists the most recent warnings and errors, which would
+// otherwise scroll out of the console between the regular messages.
+type alertsPanel struct {
+	*ui.List
+
+	mu    sync.Mutex // protects items, written from both run and key handlers
+	items []string
+}
+
+func newAlertsPanel() *alertsPanel {
+	list := ui.NewList()
+	list.Height = maxAlerts + 2
+	list.BorderLabel = "Alerts"
+	list.Items = []string{"no alerts"}
+
+	return &alertsPanel{List: list}
+}
+
+// add lists the message, coloured by its severity.
+func (p *alertsPanel) add(l level, msg string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.items) == maxAlerts {
+		p.items = p.items[1:]
+	}
+	p.items = append(p.items, th.mark(l, time.Now().Format("15:04:05")+" "+msg))
+	p.Items = append([]string(nil), p.items...)
+}
@@ -0,0 +1,189 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	ui "github.com/gizak/termui"
+)
+
+// maxAnomalies is the number of events kept in the anomaly log.
+const maxAnomalies = 100
+
+// Kinds of anomalies reported by the detectors.
+const (
+	anomalySpike      = "spike"
+	anomalyRule       = "rule"
+	anomalyLoop       = "loop"
+	anomalyTimestamp  = "timestamp"
+	anomalyStall      = "stall"
+	anomalyDisconnect = "disconnect"
+	anomalyLag        = "lag"
+	anomalyDrift      = "drift"
+)
+
+var anomalyKinds = []string{anomalySpike, anomalyRule, anomalyLoop, anomalyTimestamp, anomalyStall, anomalyDisconnect, anomalyLag, anomalyDrift}
+
+// parseAnomalyKinds parses a comma separated list of anomaly kinds.
+func parseAnomalyKinds(list string) (map[string]bool, error) {
+	kinds := make(map[string]bool)
+	for _, kind := range strings.Split(list, ",") {
+		if kind = strings.TrimSpace(kind); kind == "" {
+			continue
+		}
+		known := false
+		for _, k := range anomalyKinds {
+			known = known || k == kind
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown anomaly kind %q (known: %s)", kind, strings.Join(anomalyKinds, ","))
+		}
+		kinds[kind] = true
+	}
+	return kinds, nil
+}
+
+// anomaly is a single event raised by one of the detectors.
+type anomaly struct {
+	time   time.Time
+	kind   string
+	block  uint64 // block the event is associated with, if hasBlock
+	detail string
+
+	hasBlock bool
+}
+
+// anomalyLog collects the events of all detectors of a session into a
+// navigable list. Events are recorded by the monitor and navigated from
+// the UI goroutine.
+type anomalyLog struct {
+	*ui.List
+
+	mu       sync.Mutex
+	events   []anomaly
+	selected int // index of the selected event, -1 to follow the latest
+	console  *console
+
+	// onEvent is called with every recorded event, e.g. to pause the
+	// display. It's set before the monitor starts.
+	onEvent func(anomaly)
+}
+
+func newAnomalyLog(console *console) *anomalyLog {
+	list := ui.NewList()
+	list.Height = 8
+	list.BorderLabel = "Anomalies (up/down to select, enter to inspect)"
+	list.Items = []string{"no anomalies"}
+
+	return &anomalyLog{List: list, selected: -1, console: console}
+}
+
+// record adds an event associated with a block and mirrors it to the console.
+func (l *anomalyLog) record(kind string, block uint64, detail string) {
+	l.add(anomaly{time: time.Now(), kind: kind, block: block, detail: detail, hasBlock: true})
+}
+
+// recordf adds an event not associated with any block.
+func (l *anomalyLog) recordf(kind string, format string, a ...interface{}) {
+	l.add(anomaly{time: time.Now(), kind: kind, detail: fmt.Sprintf(format, a...)})
+}
+
+func (l *anomalyLog) add(event anomaly) {
+	severity := levelWarn
+	if event.kind == anomalySpike || event.kind == anomalyDisconnect {
+		severity = levelBad
+	}
+	l.console.alert(severity, event.detail)
+	if l.onEvent != nil {
+		l.onEvent(event)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) == maxAnomalies {
+		l.events = l.events[1:]
+		if l.selected > 0 {
+			l.selected--
+		}
+	}
+	l.events = append(l.events, event)
+	l.update()
+}
+
+// move moves the selection by delta events.
+func (l *anomalyLog) move(delta int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) == 0 {
+		return
+	}
+	sel := l.selected
+	if sel < 0 {
+		sel = len(l.events) - 1
+	}
+	sel += delta
+	switch {
+	case sel < 0:
+		sel = 0
+	case sel >= len(l.events)-1:
+		sel = -1 // back to following the latest event
+	}
+	l.selected = sel
+	l.update()
+}
+
+// current returns the selected event.
+func (l *anomalyLog) current() (anomaly, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.events) == 0 {
+		return anomaly{}, false
+	}
+	if l.selected < 0 {
+		return l.events[len(l.events)-1], true
+	}
+	return l.events[l.selected], true
+}
+
+// update renders the events around the selection into the list.
+func (l *anomalyLog) update() {
+	sel := l.selected
+	if sel < 0 {
+		sel = len(l.events) - 1
+	}
+	rows := l.Height - 2
+	if rows < 1 {
+		rows = 1
+	}
+	start := sel - rows + 1
+	if start < 0 {
+		start = 0
+	}
+	end := start + rows
+	if end > len(l.events) {
+		end = len(l.events)
+	}
+	items := make([]string, 0, end-start)
+	for i := start; i < end; i++ {
+		event := l.events[i]
+		block := "-"
+		if event.hasBlock {
+			block = "#" + formatBlockUint(event.block)
+		}
+		item := fmt.Sprintf("%s %-10s %-10s %s", event.time.Format("15:04:05"), event.kind, block, event.detail)
+		if i == sel && l.selected >= 0 {
+			item = fmt.Sprintf("[%s](fg-black,bg-white)", item)
+		}
+		items = append(items, item)
+	}
+	l.Items = items
+}
@@ -0,0 +1,61 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// backoff spaces out retries of a failing operation. The delay doubles with
+// every attempt up to max, and each wait is jittered between half and all
+// of the delay so that monitors retrying the same node don't do so in
+// lockstep.
+type backoff struct {
+	initial, max time.Duration
+	delay        time.Duration // delay before the next attempt
+}
+
+func init() {
+	// the jitter must differ between processes
+	rand.Seed(time.Now().UnixNano())
+}
+
+func newBackoff(initial, max time.Duration) *backoff {
+	return &backoff{initial: initial, max: max, delay: initial}
+}
+
+// next returns the jittered wait before the next attempt and doubles the
+// delay for the one after.
+func (b *backoff) next() time.Duration {
+	d := b.delay
+	if b.delay *= 2; b.delay > b.max || b.delay <= 0 {
+		b.delay = b.max
+	}
+	if half := d / 2; half > 0 {
+		return half + time.Duration(rand.Int63n(int64(d-half)+1))
+	}
+	return d
+}
+
+// wait blocks for the next delay, returning early with the error of ctx if
+// it's cancelled.
+func (b *backoff) wait(ctx context.Context) error {
+	t := time.NewTimer(b.next())
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// reset starts over with the initial delay after a success.
+func (b *backoff) reset() {
+	b.delay = b.initial
+}
@@ -0,0 +1,65 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestBackoffProgression(t *testing.T) {
+	b := newBackoff(100*time.Millisecond, time.Second)
+
+	// the delay doubles up to the cap, each wait jittered into [d/2, d]
+	delays := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, d := range delays {
+		if got := b.next(); got < d/2 || got > d {
+			t.Errorf("attempt %d: wait %v, want between %v and %v", i, got, d/2, d)
+		}
+	}
+	b.reset()
+	if got := b.next(); got < 50*time.Millisecond || got > 100*time.Millisecond {
+		t.Errorf("after reset: wait %v, want between 50ms and 100ms", got)
+	}
+}
+
+func TestBackoffOverflow(t *testing.T) {
+	b := newBackoff(time.Duration(1)<<62, time.Duration(1)<<62)
+	for i := 0; i < 4; i++ {
+		if got := b.next(); got <= 0 {
+			t.Fatalf("attempt %d: wait %v, want the capped delay", i, got)
+		}
+	}
+}
+
+func TestBackoffWait(t *testing.T) {
+	b := newBackoff(time.Millisecond, time.Millisecond)
+	if err := b.wait(context.Background()); err != nil {
+		t.Fatalf("wait failed: %v", err)
+	}
+}
+
+func TestBackoffWaitCancelled(t *testing.T) {
+	b := newBackoff(time.Hour, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	if err := b.wait(ctx); err != context.Canceled {
+		t.Fatalf("wait returned %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("wait returned after %v, want right after the cancellation", elapsed)
+	}
+}
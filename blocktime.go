@@ -0,0 +1,167 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockTimeUnit is the unit block times are plotted and reported in, either
+// "s" or "ms". It's set from the -blocktime-unit flag.
+var blockTimeUnit = "s"
+
+// blockTimeScales holds the number of units per second of each unit.
+var blockTimeScales = map[string]int64{
+	"s":  1,
+	"ms": 1000,
+}
+
+// validBlockTimeUnit returns an error if the block time unit is unknown.
+func validBlockTimeUnit(unit string) error {
+	if _, ok := blockTimeScales[unit]; !ok {
+		return fmt.Errorf("invalid block time unit %q: must be s or ms", unit)
+	}
+	return nil
+}
+
+// blockTimeValue converts a block time in seconds, as derived from header
+// timestamps, into the configured unit. Values that don't fit an int32, as
+// produced by bogus timestamps, are clamped rather than wrapped around.
+func blockTimeValue(seconds *big.Int) int {
+	return sampleValue(new(big.Int).Mul(seconds, big.NewInt(blockTimeScales[blockTimeUnit])), nil)
+}
+
+// blockTimeDuration converts a locally measured duration into the
+// configured block time unit.
+func blockTimeDuration(d time.Duration) int {
+	unit := time.Second / time.Duration(blockTimeScales[blockTimeUnit])
+	return int((d + unit/2) / unit)
+}
+
+// formatBlockTime formats a block time in the configured unit.
+func formatBlockTime(v float64) string {
+	return formatFloat(v) + blockTimeUnit
+}
+
+// expectedInterval is the block interval of the chain in nanoseconds, which
+// the block rate colouring and the health checks are relative to. It's set
+// from -block-time or detected from the backfilled blocks.
+var expectedInterval = int64(defaultBlockTime)
+
+// expectedBlockTime returns the expected block interval of the chain.
+func expectedBlockTime() time.Duration {
+	return time.Duration(atomic.LoadInt64(&expectedInterval))
+}
+
+// setExpectedBlockTime changes the expected block interval of the chain.
+func setExpectedBlockTime(d time.Duration) {
+	atomic.StoreInt64(&expectedInterval, int64(d))
+}
+
+// medianBlockTime returns the median interval between the consecutive
+// headers. ok is false if there are too few headers to tell.
+func medianBlockTime(headers []*types.Header) (d time.Duration, ok bool) {
+	var deltas []int
+	for i := 1; i < len(headers); i++ {
+		if headers[i].Time.Cmp(headers[i-1].Time) >= 0 {
+			deltas = append(deltas, sampleValue(new(big.Int).Sub(headers[i].Time, headers[i-1].Time), nil))
+		}
+	}
+	if len(deltas) < 2 {
+		return 0, false
+	}
+	return time.Duration(median(deltas) * float64(time.Second)), true
+}
+
+// blockTimeObserver measures the block times, feeding the block time graph,
+// the block rate and the block time correlation. It sets the block time
+// metric for the observers registered after it. It's only accessed from run.
+type blockTimeObserver struct {
+	dash   *dashboard
+	sess   *session
+	trim   int // percentage trimmed off each end for the block time mean
+	sample *sampler
+	corr   *correlations
+
+	stamps timestampRun
+	series []int    // block times in the block time unit
+	times  []uint64 // timestamps of the last rateWindow blocks
+}
+
+func newBlockTimeObserver(dash *dashboard, sess *session, cfg *config, corr *correlations) *blockTimeObserver {
+	return &blockTimeObserver{
+		dash:   dash,
+		sess:   sess,
+		trim:   cfg.trim,
+		sample: newSampler(cfg.sampleSize, cfg.sampleSpan),
+		corr:   corr,
+	}
+}
+
+func (o *blockTimeObserver) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	parent := state.parent
+
+	// identical timestamps would make for zero block times, so the local
+	// arrival delta is plotted instead while they last
+	identical, fallback, ended := o.stamps.observe(header, parent, state.arrival)
+	switch {
+	case identical:
+		if o.stamps.length == 2 {
+			o.dash.console.writef("Block time: identical block timestamps from block %s on, approximating block times with arrival times", formatBlockNumber(parent.Number))
+		}
+		o.sample.addBlockTime(blockTimeDuration(fallback))
+		if fallback > 0 {
+			o.sess.addBlockTime(blockTimeDuration(fallback))
+		}
+	case parent != nil && !isEarlyBlock(parent) && header.Time.Cmp(parent.Time) > 0:
+		delta := new(big.Int).Sub(header.Time, parent.Time)
+		o.sample.addBlockTime(blockTimeValue(delta))
+		o.sess.addBlockTime(blockTimeValue(delta))
+		state.metrics[metricBlockTime] = float64(delta.Uint64())
+
+		o.corr.addBlockTime(state.metrics[metricBlockTime], float64(header.GasUsed.Uint64()))
+		if o.corr.samples() == 1 {
+			o.dash.reveal("corr")
+		}
+		o.dash.corr.Text = o.corr.text()
+		o.dash.touch(o.dash.corr)
+	}
+	if ended > 0 {
+		o.dash.anomalies.record(anomalyTimestamp, header.Number.Uint64(), fmt.Sprintf("%d blocks with identical timestamp, their block times were approximated with arrival times (%d in total)", ended, o.stamps.total))
+	}
+
+	if o.sample.addBlock(header.Time.Uint64()) {
+		if p := o.sample.flush(); p.hasTime {
+			graph := o.dash.blockTime
+			o.series = pushSample(o.series, p.blockTime)
+			graph.Lines[0].Data = o.series
+			o.sess.record("Block time ("+blockTimeUnit+")", o.series)
+			graph.BorderLabel = blockTimeLabel(o.series, o.trim, o.dash.showTrimmed.on())
+			o.dash.touch(graph)
+		}
+	}
+
+	if !isEarlyBlock(header) {
+		if len(o.times) == rateWindow {
+			o.times = o.times[1:]
+		}
+		o.times = append(o.times, header.Time.Uint64())
+	}
+	if r := blockRate(o.times); r > 0 {
+		rate := o.dash.rate
+		rate.Text = th.cue(rateLevel(r)) + formatFloat(r) + " blocks/min"
+		if dropped := o.sess.droppedHeads(); dropped > 0 {
+			rate.Text += fmt.Sprintf(", dropped %d heads", dropped)
+		}
+		rate.TextFgColor = th.color(rateLevel(r))
+		o.dash.touch(rate)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	ui "github.com/gizak/termui"
+)
+
+// builderTag labels the blocks of a builder or relay, identified by the
+// coinbase address or a substring of the extra data, e.g.
+//
+//	{"label": "flashbots", "color": "green", "extra": "flashbots"}
+type builderTag struct {
+	Label    string `json:"label"`
+	Color    string `json:"color"`
+	Coinbase string `json:"coinbase"` // fee recipient of the block
+	Extra    string `json:"extra"`    // case insensitive substring of the extra data
+
+	coinbase *common.Address
+	color    ui.Attribute
+}
+
+// builderColors are the colours a builder tag can be drawn in.
+var builderColors = map[string]ui.Attribute{
+	"red":     ui.ColorRed,
+	"green":   ui.ColorGreen,
+	"yellow":  ui.ColorYellow,
+	"blue":    ui.ColorBlue,
+	"magenta": ui.ColorMagenta,
+	"cyan":    ui.ColorCyan,
+	"white":   ui.ColorWhite,
+}
+
+// builders are the tags blocks are matched against, loaded with the
+// -builders flag.
+var builders []*builderTag
+
+// loadBuilders reads a JSON array of builder tags. Tags are matched in
+// order, the first matching tag labels the block.
+func loadBuilders(path string) ([]*builderTag, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var tags []*builderTag
+	if err := json.Unmarshal(blob, &tags); err != nil {
+		return nil, fmt.Errorf("invalid builders %s: %v", path, err)
+	}
+	for i, t := range tags {
+		if t.Label == "" {
+			return nil, fmt.Errorf("invalid builders %s: tag %d has no label", path, i)
+		}
+		if t.Coinbase == "" && t.Extra == "" {
+			return nil, fmt.Errorf("invalid builders %s: tag %s matches no coinbase or extra data", path, t.Label)
+		}
+		if t.Coinbase != "" {
+			if !common.IsHexAddress(t.Coinbase) {
+				return nil, fmt.Errorf("invalid builders %s: invalid coinbase %q", path, t.Coinbase)
+			}
+			addr := common.HexToAddress(t.Coinbase)
+			t.coinbase = &addr
+		}
+		if t.Color == "" {
+			t.Color = "cyan"
+		}
+		color, ok := builderColors[t.Color]
+		if !ok {
+			return nil, fmt.Errorf("invalid builders %s: unknown color %q", path, t.Color)
+		}
+		t.color = color
+		t.Extra = strings.ToLower(t.Extra)
+	}
+	return tags, nil
+}
+
+// matchBuilder returns the index of the first tag matching the block, or -1
+// if none does.
+func matchBuilder(tags []*builderTag, header *types.Header) int {
+	extra := strings.ToLower(string(header.Extra))
+	for i, t := range tags {
+		if t.coinbase != nil && *t.coinbase == header.Coinbase {
+			return i
+		}
+		if t.Extra != "" && strings.Contains(extra, t.Extra) {
+			return i
+		}
+	}
+	return -1
+}
+
+// builderLabel returns the label of the tag matching the block, or "-".
+func builderLabel(header *types.Header) string {
+	if i := matchBuilder(builders, header); i >= 0 {
+		return builders[i].Label
+	}
+	return "-"
+}
+
+// builderMarkup renders the label of the tag in its colour.
+func builderMarkup(t *builderTag) string {
+	return fmt.Sprintf("[%s](fg-%s)", t.Label, t.Color)
+}
+
+// builderMarkColors returns the mark colours of the tags, aligned with the
+// marks of builderMark.
+func builderMarkColors(tags []*builderTag) []ui.Attribute {
+	colors := make([]ui.Attribute, len(tags))
+	for i, t := range tags {
+		colors[i] = t.color
+	}
+	return colors
+}
+
+// builderMark returns the graph mark of the block, 0 if it's untagged.
+func builderMark(tags []*builderTag, header *types.Header) int {
+	return matchBuilder(tags, header) + 1
+}
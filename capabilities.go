@@ -0,0 +1,122 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/rpc"
+	ui "github.com/gizak/termui"
+)
+
+// capabilities records which of the probed RPC methods are supported by the
+// node the monitor is attached to. Capabilities of disabled features aren't
+// probed and have no entry.
+type capabilities map[string]bool
+
+// Names of the probed capabilities.
+const (
+	capSubscribe   = "eth_subscribe"
+	capBlockByHash = "eth_getBlockByHash"
+	capTxPool      = "txpool_status"
+	capSyncing     = "eth_syncing"
+	capFinalized   = "finalized tag"
+	capFeeHistory  = "eth_feeHistory"
+)
+
+// probeOrder is the order in which capabilities are probed and displayed.
+var probeOrder = []string{capSubscribe, capBlockByHash, capTxPool, capSyncing, capFinalized, capFeeHistory}
+
+// probeCapabilities tests the RPC methods used by the various panels and
+// reports which of them succeeded. Failures are logged to the console.
+func probeCapabilities(ctx context.Context, client *rpc.Client, cfg *config, console *console) capabilities {
+	caps := make(capabilities)
+
+	probes := map[string]func() error{
+		capSubscribe: func() error {
+			sub, err := client.EthSubscribe(ctx, make(chan json.RawMessage), "newHeads")
+			if err != nil {
+				return err
+			}
+			sub.Unsubscribe()
+			return nil
+		},
+		capBlockByHash: func() error {
+			var head struct {
+				Hash string `json:"hash"`
+			}
+			if err := client.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false); err != nil {
+				return err
+			}
+			var block json.RawMessage
+			return client.CallContext(ctx, &block, "eth_getBlockByHash", head.Hash, false)
+		},
+		capTxPool: func() error {
+			var status json.RawMessage
+			return client.CallContext(ctx, &status, "txpool_status")
+		},
+		capSyncing: func() error {
+			var syncing json.RawMessage
+			return client.CallContext(ctx, &syncing, "eth_syncing")
+		},
+		capFinalized: func() error {
+			var block json.RawMessage
+			if err := client.CallContext(ctx, &block, "eth_getBlockByNumber", "finalized", false); err != nil {
+				return err
+			}
+			if string(block) == "null" {
+				return fmt.Errorf("no finalized block")
+			}
+			return nil
+		},
+	}
+	if cfg.feeHistory > 0 {
+		// probed the way the panel requests it, some nodes reject percentiles
+		probes[capFeeHistory] = func() error {
+			_, err := fetchFeeHistory(ctx, client, 1, cfg.rewardPcts)
+			return err
+		}
+	}
+	for _, name := range probeOrder {
+		probe, ok := probes[name]
+		if !ok {
+			continue
+		}
+		err := probe()
+		if err != nil {
+			console.writef("Capability %s unavailable: %v", name, err)
+		}
+		caps[name] = err == nil
+	}
+	return caps
+}
+
+func newCapabilitiesList() *ui.List {
+	list := ui.NewList()
+	list.Height = len(probeOrder) + 2
+	list.BorderLabel = "Capabilities"
+	list.Items = []string{"probing..."}
+
+	return list
+}
+
+// updateCapabilitiesList renders the probe results into the list.
+func updateCapabilitiesList(list *ui.List, caps capabilities) {
+	items := make([]string, len(probeOrder))
+	for i, name := range probeOrder {
+		supported, probed := caps[name]
+		switch {
+		case !probed:
+			items[i] = "off " + name
+		case supported:
+			items[i] = th.paint(levelGood, "ok  "+name)
+		default:
+			items[i] = th.paint(levelBad, "--  "+name)
+		}
+	}
+	list.Items = items
+}
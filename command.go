@@ -0,0 +1,97 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ui "github.com/gizak/termui"
+)
+
+// commandBar is a single line input drawn over the bottom of the dashboard
+// while a command is typed. It's opened with ':' and only accessed from the
+// UI goroutine.
+type commandBar struct {
+	*ui.Par
+
+	active bool
+	input  string
+}
+
+func newCommandBar() *commandBar {
+	par := ui.NewPar("")
+	par.Height = 3
+	par.BorderLabel = "Command (enter to run, esc to cancel)"
+	par.BorderFg = th.popup
+
+	return &commandBar{Par: par}
+}
+
+// open activates the bar with an empty input at the bottom of the terminal.
+func (b *commandBar) open() {
+	b.active = true
+	b.input = ""
+	b.Width = ui.TermWidth()
+	b.Y = ui.TermHeight() - b.Height
+	b.Text = ":"
+}
+
+// key feeds a key press to the bar. When the input is completed with enter,
+// done is set and line holds the typed command. Escape closes the bar
+// without a command.
+func (b *commandBar) key(k string) (line string, done bool) {
+	switch k {
+	case "<enter>":
+		b.active = false
+		return strings.TrimSpace(b.input), true
+	case "<escape>":
+		b.active = false
+		return "", true
+	case "<backspace>", "C-8":
+		if len(b.input) > 0 {
+			b.input = b.input[:len(b.input)-1]
+		}
+	case "<space>":
+		b.input += " "
+	default:
+		// ignore the names of other special keys
+		if len(k) == 1 {
+			b.input += k
+		}
+	}
+	b.Text = ":" + b.input
+	return "", false
+}
+
+// command is an action run from the command bar.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// dispatch parses the command line and runs the matching command.
+func dispatch(line string, commands map[string]command) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	cmd, ok := commands[fields[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, try help", fields[0])
+	}
+	return cmd.run(fields[1:])
+}
+
+// commandHelp lists the usage of all commands.
+func commandHelp(commands map[string]command) []string {
+	lines := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		lines = append(lines, cmd.usage)
+	}
+	sort.Strings(lines)
+	return lines
+}
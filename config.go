@@ -0,0 +1,266 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// config holds the settings of the monitor as resolved from the command
+// line.
+type config struct {
+	path       string        // endpoint of the node
+	sampleSize int           // number of blocks per graph point
+	sampleSpan time.Duration // block time per graph point, 0 to sample by sampleSize
+	scale      string        // gas used scaling mode
+	fetch      bool          // fetch full blocks for per transaction metrics
+	receipts   bool          // fetch receipts along with full blocks
+	trim       int           // percentage trimmed off each end for the block time mean
+	headBuffer int           // capacity of the head channel
+
+	headTimeout time.Duration // time without heads before falling back to polling
+	idleExit    time.Duration // time without heads before exiting, 0 to never exit
+	driftMax    time.Duration // clock drift between node and local time warned about
+
+	backoffInitial time.Duration // first delay between retries of a failed request
+	backoffMax     time.Duration // cap of the doubling delay between retries
+	blockTime      time.Duration // expected block interval, 0 to detect it
+
+	gasMax       uint64   // pinned maximum of the gas used graph, 0 if auto
+	gasLevels    []uint64 // notable gas limits whose crossing is highlighted
+	blockTimeMax int      // pinned maximum of the block time graph in the block time unit, 0 if auto
+
+	utilisationDecay float64 // weight of the newest block in the long-term gas used average
+
+	spikePct    float64 // fee rise in percent reported as a spike, 0 if disabled
+	spikeBlocks int     // number of blocks the fee rise is measured over
+	spikeLog    string  // file the spike snapshots are appended to, if any
+	spikePrice  bool    // whether the suggested gas price stands in for missing base fees
+
+	recipientNames map[common.Address]string // names of withdrawal recipients
+	feePercentiles []float64                 // gas price percentiles listed for fetched blocks
+	feeHistory     int                       // blocks requested from eth_feeHistory, 0 if disabled
+	rewardPcts     []float64                 // reward percentiles requested from eth_feeHistory
+	overlay        []string                  // series overlaid in a single graph
+
+	rules       []*rule // rules flagging interesting blocks
+	ruleWebhook string  // URL rule matches are posted to, if any
+
+	statePath string // file the per endpoint stats are kept in, if any
+	peers     bool   // poll the peers of the node
+}
+
+// endpointKey is the config file key holding the node endpoint, which is
+// otherwise given as the first command line argument.
+const endpointKey = "endpoint"
+
+// applyConfigFile loads the config file at path and sets every flag named
+// in it that isn't in explicit, the flags set on the command line, so that
+// command line flags override file values. The file is a single object keyed by flag
+// name, e.g.
+//
+//	{"endpoint": "/path/to/geth.ipc", "panels": "gas,console", "precision": 4}
+//
+// Files ending in .toml or .yaml/.yml hold the same flat settings as TOML or
+// YAML, see parseFlatConfig. The endpoint from the file is returned, if any.
+func applyConfigFile(path string, explicit map[string]bool) (string, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var settings map[string]interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		settings, err = parseFlatConfig(blob, "=")
+	case ".yaml", ".yml":
+		settings, err = parseFlatConfig(blob, ":")
+	default:
+		// keep numbers in their literal form so large values don't end up
+		// in exponent notation when handed to the flag parsers
+		dec := json.NewDecoder(bytes.NewReader(blob))
+		dec.UseNumber()
+		err = dec.Decode(&settings)
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	var endpoint string
+	for name, value := range settings {
+		if name == endpointKey {
+			endpoint = fmt.Sprint(value)
+			continue
+		}
+		if flag.Lookup(name) == nil {
+			return "", fmt.Errorf("invalid config file %s: unknown setting %q", path, name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := flag.Set(name, fmt.Sprint(value)); err != nil {
+			return "", fmt.Errorf("invalid config file %s: setting %q: %v", path, name, err)
+		}
+	}
+	return endpoint, nil
+}
+
+// parseFlatConfig parses the flat subset of TOML and YAML config files use:
+// one "name = value" or "name: value" line per setting, split at the first
+// sep, with # comments. Values may be quoted, and lists such as
+// ["gas", "console"] are joined with commas the way list flags expect them.
+// Tables and nested values have no flag to set and are rejected.
+func parseFlatConfig(blob []byte, sep string) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	for i, line := range strings.Split(string(blob), "\n") {
+		line = strings.TrimRight(stripComment(line), " \t\r")
+		if strings.TrimSpace(line) == "" || line == "---" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' || line[0] == '[' || strings.HasPrefix(line, "- ") {
+			return nil, fmt.Errorf("line %d: only flat settings are supported, e.g. panels %s gas,console", i+1, sep)
+		}
+		n := strings.Index(line, sep)
+		if n < 0 {
+			return nil, fmt.Errorf("line %d: expected name %s value", i+1, sep)
+		}
+		name := strings.TrimSpace(line[:n])
+		value := strings.TrimSpace(line[n+len(sep):])
+		if _, ok := settings[name]; ok {
+			return nil, fmt.Errorf("line %d: duplicate setting %q", i+1, name)
+		}
+		settings[name] = flatValue(value)
+	}
+	return settings, nil
+}
+
+// stripComment cuts a # comment off the line, unless the # is quoted.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// flatValue unquotes a value and joins list values with commas.
+func flatValue(value string) string {
+	if len(value) >= 2 && value[0] == '[' && value[len(value)-1] == ']' {
+		var items []string
+		for _, item := range strings.Split(value[1:len(value)-1], ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, flatValue(item))
+			}
+		}
+		return strings.Join(items, ",")
+	}
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// defaultConfig returns the first existing config file of the user, e.g.
+// ~/.config/moneth/config.toml, used without -config. Without one, all
+// settings keep their defaults and the empty string is returned.
+func defaultConfig() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	for _, name := range []string{"config.json", "config.toml", "config.yaml", "config.yml"} {
+		path := filepath.Join(dir, "moneth", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// envPrefix is the prefix of environment variables setting flags, e.g.
+// MONETH_HEAD_BUFFER sets -head-buffer.
+const envPrefix = "MONETH_"
+
+// envName returns the environment variable of the named flag.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// configPath returns the config file to load: the one given with -config on
+// the command line, else the one named by MONETH_CONFIG, else the default
+// config of the user, if any.
+func configPath(flagValue string, explicit map[string]bool) string {
+	if explicit["config"] {
+		return flagValue
+	}
+	if path, ok := os.LookupEnv(envName("config")); ok {
+		return path
+	}
+	return defaultConfig()
+}
+
+// commandLineFlags returns the names of the flags set on the command line.
+// It must be called right after flag.Parse, before the config file and the
+// environment set flags, which flag.Visit can't tell apart.
+func commandLineFlags() map[string]bool {
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	return explicit
+}
+
+// applyEnv sets every flag that wasn't set explicitly on the command line
+// from its environment variable, if present, overriding config file values.
+// MONETH_CONFIG is left to configPath, as the file is loaded by then. The
+// endpoint may be given as MONETH_ENDPOINT; it's returned if set.
+func applyEnv(explicit map[string]bool) (string, error) {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(f.Name))
+		if !ok || explicit[f.Name] || f.Name == "config" || err != nil {
+			return
+		}
+		if serr := f.Value.Set(value); serr != nil {
+			err = fmt.Errorf("invalid %s: %v", envName(f.Name), serr)
+		}
+	})
+	return os.Getenv(envName(endpointKey)), err
+}
+
+// printConfig writes the effective value of every flag together with the
+// endpoint as JSON. The output can be used as a -config file.
+func printConfig(w io.Writer, endpoint string) error {
+	settings := map[string]string{endpointKey: endpoint}
+	flag.VisitAll(func(f *flag.Flag) {
+		if f.Name != "config" && f.Name != "print-config" {
+			settings[f.Name] = f.Value.String()
+		}
+	})
+	blob, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", blob)
+	return err
+}
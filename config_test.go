@@ -0,0 +1,76 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setEnv sets the environment variable and returns a func restoring it.
+func setEnv(name, value string) func() {
+	old, had := os.LookupEnv(name)
+	os.Setenv(name, value)
+	return func() {
+		if had {
+			os.Setenv(name, old)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// saveFlag returns a func resetting the named flag to its current value.
+func saveFlag(name string) func() {
+	old := flag.Lookup(name).Value.String()
+	return func() { flag.Set(name, old) }
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "moneth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "moneth.json")
+	if err := ioutil.WriteFile(path, []byte(`{"endpoint": "ws://node:8546", "precision": 5, "trim": 20}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer setEnv("MONETH_CONFIG", path)()
+	defer setEnv("MONETH_TRIM", "30")()
+	defer saveFlag("precision")()
+	defer saveFlag("trim")()
+
+	explicit := map[string]bool{}
+	if got := configPath("", explicit); got != path {
+		t.Fatalf("config path %q, want %q from MONETH_CONFIG", got, path)
+	}
+	endpoint, err := applyConfigFile(path, explicit)
+	if err != nil {
+		t.Fatalf("failed to apply the config file: %v", err)
+	}
+	if _, err := applyEnv(explicit); err != nil {
+		t.Fatalf("failed to apply the environment: %v", err)
+	}
+	if endpoint != "ws://node:8546" {
+		t.Errorf("endpoint %q, want the one of the file", endpoint)
+	}
+	if got := flag.Lookup("precision").Value.String(); got != "5" {
+		t.Errorf("precision %s, want 5 from the file", got)
+	}
+	// the environment overrides the file
+	if got := flag.Lookup("trim").Value.String(); got != "30" {
+		t.Errorf("trim %s, want 30 from MONETH_TRIM", got)
+	}
+
+	// -config on the command line takes precedence over MONETH_CONFIG
+	if got := configPath("other.json", map[string]bool{"config": true}); got != "other.json" {
+		t.Errorf("config path %q, want other.json from the command line", got)
+	}
+}
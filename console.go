@@ -0,0 +1,247 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	ui "github.com/gizak/termui"
+)
+
+// console embeds a ui.Par which is used to write out
+// log messages. It keeps track of the messages in a
+// buffer such that old messages can be evicted if the
+// buffer is too full.
+type console struct {
+	*ui.Par
+
+	mu     sync.Mutex // protects msgs, written from both run and key handlers
+	msgs   []message
+	hidden map[string]bool // categories left out of the display
+	log    io.Writer       // optional log file every message is mirrored to
+	dirty  bool            // whether messages were added since the last render
+
+	alerts *alertsPanel // optional panel alerts are mirrored to
+	sess   *session     // optional session alerts are recorded in for the report
+
+	baseHeight int  // height of the console without unread alerts
+	maxHeight  int  // height the console may expand to with unread alerts
+	expand     bool // whether the console expands with unread alerts
+	unread     int  // number of alerts since the last acknowledgement
+}
+
+// newConsole returns a new console
+func newConsole(height int) *console {
+	par := ui.NewPar("")
+	par.Height = height
+	par.BorderLabel = "Console"
+	stripChrome(&par.Block)
+
+	return &console{Par: par, hidden: make(map[string]bool), baseHeight: height, maxHeight: height}
+}
+
+// Console message categories, which can be hidden from the display.
+const (
+	msgBlock = "block" // a line for every block
+	msgAlert = "alert" // warnings and errors
+	msgInfo  = "info"  // everything else
+	msgDebug = "debug" // diagnostics of the monitor itself
+)
+
+var msgCategories = []string{msgBlock, msgAlert, msgInfo, msgDebug}
+
+// validCategory returns an error if name isn't a message category.
+func validCategory(name string) error {
+	for _, c := range msgCategories {
+		if c == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown message category %q (known: %s)", name, strings.Join(msgCategories, ","))
+}
+
+// message is a console message along with its category.
+type message struct {
+	category string
+	text     string
+}
+
+// consoleHistory is the number of messages kept, so that hiding a chatty
+// category still leaves older messages to show.
+const consoleHistory = 200
+
+// setExpansion lets the console expand up to max lines while there are
+// unread alerts. A max not above the base height disables the expansion.
+func (c *console) setExpansion(max int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if max < c.baseHeight {
+		max = c.baseHeight
+	}
+	c.maxHeight = max
+	c.expand = max > c.baseHeight
+}
+
+// setHeight changes the height of the console without unread alerts. It
+// must be called before setExpansion.
+func (c *console) setHeight(rows int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Par.Height, c.baseHeight, c.maxHeight = rows, rows, rows
+}
+
+// toggleExpansion turns the expansion on or off and reports the new state.
+func (c *console) toggleExpansion() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expand = !c.expand && c.maxHeight > c.baseHeight
+	return c.expand
+}
+
+// ack acknowledges the unread alerts, shrinking the console back.
+func (c *console) ack() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.unread = 0
+}
+
+// fit resizes the console to make room for the unread alerts and returns
+// the number of lines it's expanded by. changed is set if the height
+// changed, which requires a new layout.
+func (c *console) fit() (extra int, changed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	height := c.baseHeight
+	if c.expand && c.unread > 0 {
+		if height += c.unread; height > c.maxHeight {
+			height = c.maxHeight
+		}
+	}
+	changed = height != c.Par.Height
+	if changed {
+		c.Par.Height = height
+		c.render()
+	}
+	return height - c.baseHeight, changed
+}
+
+// setLog mirrors all subsequent messages to w.
+func (c *console) setLog(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.log = w
+}
+
+// setHidden hides or shows the messages of the category, including those
+// written before.
+func (c *console) setHidden(category string, hidden bool) error {
+	if err := validCategory(category); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.hidden[category] = hidden
+	c.render()
+	return nil
+}
+
+// hide hides the messages of the comma separated list of categories.
+func (c *console) hide(list string) error {
+	for _, category := range strings.Split(list, ",") {
+		if category = strings.TrimSpace(category); category == "" {
+			continue
+		}
+		if err := c.setHidden(category, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *console) writeln(msg ...interface{}) {
+	c.add(msgInfo, fmt.Sprint(msg...))
+}
+
+func (c *console) writef(format string, a ...interface{}) {
+	c.add(msgInfo, fmt.Sprintf(format, a...))
+}
+
+// logf writes a message of the given category.
+func (c *console) logf(category string, format string, a ...interface{}) {
+	c.add(category, fmt.Sprintf(format, a...))
+}
+
+// alert writes a warning or error, which is mirrored to the alerts panel.
+func (c *console) alert(l level, msg string) {
+	prefix := "WARN: "
+	if l == levelBad {
+		prefix = "ERROR: "
+	}
+	c.add(msgAlert, prefix+msg)
+	if c.alerts != nil {
+		c.alerts.add(l, msg)
+	}
+	if c.sess != nil {
+		c.sess.addAlert(l, msg)
+	}
+}
+
+func (c *console) add(category, msg string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.msgs) >= consoleHistory {
+		c.msgs = c.msgs[1:]
+	}
+	c.msgs = append(c.msgs, message{category: category, text: msg})
+	if category == msgAlert {
+		c.unread++
+	}
+	c.render()
+
+	if c.log != nil {
+		fmt.Fprintln(c.log, msg)
+	}
+}
+
+// render shows as many of the latest messages of the shown categories as
+// fit the console.
+func (c *console) render() {
+	var msgs []string
+	rows := c.Par.Height
+	if c.Par.Border {
+		rows -= 2
+	}
+	for i := len(c.msgs) - 1; i >= 0 && len(msgs) < rows; i-- {
+		if !c.hidden[c.msgs[i].category] {
+			msgs = append(msgs, c.msgs[i].text)
+		}
+	}
+	for i, j := 0, len(msgs)-1; i < j; i, j = i+1, j-1 {
+		msgs[i], msgs[j] = msgs[j], msgs[i]
+	}
+	c.Par.Text = strings.Join(msgs, "\n")
+	c.dirty = true
+}
+
+// takeDirty reports whether messages were added since the last call.
+func (c *console) takeDirty() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dirty := c.dirty
+	c.dirty = false
+	return dirty
+}
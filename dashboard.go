@@ -0,0 +1,651 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	ui "github.com/gizak/termui"
+)
+
+// Column placement of a panel within the layout.
+const (
+	colLeft = iota
+	colRight
+	colBottom
+	colTop // full width above the left and right columns
+)
+
+// toggle is a boolean switched by key handlers and read by the monitor.
+type toggle struct {
+	v int32
+}
+
+// flip inverts the toggle and returns the new value.
+func (t *toggle) flip() bool {
+	for {
+		old := atomic.LoadInt32(&t.v)
+		if atomic.CompareAndSwapInt32(&t.v, old, 1-old) {
+			return old == 0
+		}
+	}
+}
+
+// set sets the toggle to v.
+func (t *toggle) set(v bool) {
+	if v {
+		atomic.StoreInt32(&t.v, 1)
+	} else {
+		atomic.StoreInt32(&t.v, 0)
+	}
+}
+
+// on returns the current value of the toggle.
+func (t *toggle) on() bool {
+	return atomic.LoadInt32(&t.v) == 1
+}
+
+// panel is a named widget of the dashboard that can be shown or hidden at
+// runtime using its toggle key.
+type panel struct {
+	name    string
+	key     string
+	column  int
+	widget  ui.GridBufferer
+	enabled bool
+}
+
+// tab is a named set of panels. Only the panels of the active tab are laid
+// out, the status bar is shown on every tab.
+type tab struct {
+	name   string
+	panels map[string]bool
+}
+
+// dashboard holds all the widgets the monitor writes to, together with the
+// panels they're laid out in.
+type dashboard struct {
+	console   *console
+	gas       *graph
+	blockTime *graph
+	rate      *ui.Par
+	gasCmp    *ui.MBarChart
+	caps      *ui.List
+	txGas     *ui.Par
+	topTx     *ui.List
+	gasPrice  *ui.Sparklines
+	l1        *ui.Par
+	proc      *graph
+	token     *ui.Sparklines
+	txShare   *ui.Sparklines
+	withdraw  *ui.List
+	corr      *ui.Par
+	stateRoot *ui.Par
+	fees      *ui.List
+	feeHist   *ui.Sparklines
+	peers     *ui.Sparklines
+	peerList  *ui.List
+	txPool    *ui.Sparklines
+	poolUsage *ui.Gauge
+	sync      *syncPanel
+	nodes     *ui.List
+	overlay   *graph
+	extremes  *extremesPanel
+	anomalies *anomalyLog
+	alerts    *alertsPanel
+	details   *detailsPopup
+	cmd       *commandBar
+	status    *statusBar
+
+	panels   []*panel
+	tabs     []*tab             // no tabs lays out all enabled panels
+	active   int                // index of the active tab
+	commands map[string]command // commands run from the command bar
+
+	showTrimmed toggle // show the trimmed block time mean
+	showPercent toggle // show the gas used percentage lines, applied by run
+
+	// heights of the top graphs, which shrink while the console expands
+	gasHeight, blockTimeHeight int
+
+	mu       sync.Mutex           // protects dirty, reveals and pause, touched from run
+	dirty    map[ui.Bufferer]bool // widgets changed since the last render
+	revealed []string             // panels to show on the next render
+
+	paused      bool    // whether redrawing is suspended
+	pauseReason string  // why the display was paused
+	banner      *ui.Par // shown on top while paused
+}
+
+// newDashboard creates all widgets and registers them as panels. Panel
+// toggle keys are assigned in registration order from toggleKeys.
+func newDashboard() *dashboard {
+	d := &dashboard{
+		console:   newConsole(7),
+		gas:       newGasGraph(),
+		blockTime: newBlockTimeGraph(),
+		rate:      newBlockRatePar(),
+		gasCmp:    newGasComparisonChart(),
+		caps:      newCapabilitiesList(),
+		txGas:     newTxGasPar(),
+		topTx:     newTopTxList(),
+		gasPrice:  newGasPriceGraph(),
+		l1:        newL1Par(),
+		proc:      newProcGraph(),
+		token:     newTokenGraph(),
+		txShare:   newTxShareGraph(),
+		withdraw:  newWithdrawalsList(),
+		corr:      newCorrelationPar(),
+		stateRoot: newStateRootPar(),
+		fees:      newFeePercentilesList(),
+		feeHist:   newFeeHistoryGraph(),
+		peers:     newPeerCountGraph(),
+		peerList:  newPeerList(),
+		txPool:    newTxPoolGraph(),
+		poolUsage: newTxPoolGauge(),
+		sync:      newSyncPanel(),
+		nodes:     newNodesList(),
+		overlay:   newOverlayGraph(nil, false),
+		extremes:  newExtremesPanel(),
+		details:   newDetailsPopup(),
+		cmd:       newCommandBar(),
+		status:    newStatusBar(),
+		dirty:     make(map[ui.Bufferer]bool),
+	}
+	d.showTrimmed.flip()
+
+	d.anomalies = newAnomalyLog(d.console)
+	d.banner = ui.NewPar("")
+	d.banner.Height = 3
+	d.banner.BorderLabel = "Paused"
+	d.banner.BorderFg = th.popup
+	d.alerts = newAlertsPanel()
+	d.console.alerts = d.alerts
+	d.gasHeight, d.blockTimeHeight = d.gas.Height, d.blockTime.Height
+
+	d.register("gas", colLeft, d.gas)
+	d.register("caps", colLeft, d.caps)
+	d.register("blocktime", colRight, d.blockTime)
+	d.register("rate", colRight, d.rate)
+	d.register("gascmp", colRight, d.gasCmp)
+	d.register("txgas", colLeft, d.txGas)
+	d.register("toptx", colLeft, d.topTx)
+	d.register("gasprice", colRight, d.gasPrice)
+	d.register("corr", colRight, d.corr)
+	d.register("fees", colRight, d.fees)
+	d.register("txshare", colRight, d.txShare)
+	d.register("proc", colRight, d.proc)
+	d.register("token", colLeft, d.token)
+	d.register("withdrawals", colLeft, d.withdraw)
+	d.register("overlay", colLeft, d.overlay)
+	d.register("l1", colBottom, d.l1)
+	d.register("alerts", colRight, d.alerts)
+	d.register("anomalies", colBottom, d.anomalies)
+	d.register("console", colBottom, d.console)
+	d.register("status", colBottom, d.status)
+	d.register("extremes", colRight, d.extremes)
+	d.register("stateroot", colRight, d.stateRoot)
+	d.register("feehistory", colRight, d.feeHist)
+	d.register("peers", colLeft, d.peers)
+	d.register("peerlist", colLeft, d.peerList)
+	d.register("txpool", colRight, d.txPool)
+	d.register("poolusage", colRight, d.poolUsage)
+	d.register("sync", colTop, d.sync)
+	d.register("nodes", colTop, d.nodes)
+
+	return d
+}
+
+// toggleKeys are the keys assigned to the panels in registration order.
+var toggleKeys = []string{
+	"1", "2", "3", "4", "5", "6", "7", "8", "9", "0",
+	"<f1>", "<f2>", "<f3>", "<f4>", "<f5>", "<f6>", "<f7>", "<f8>", "<f9>", "<f10>", "<f11>", "<f12>",
+	"!", "@", "#", "$", "%", "^", "&", "*", "(", ")",
+}
+
+func (d *dashboard) register(name string, column int, widget ui.GridBufferer) {
+	d.panels = append(d.panels, &panel{
+		name:    name,
+		key:     toggleKeys[len(d.panels)],
+		column:  column,
+		widget:  widget,
+		enabled: true,
+	})
+}
+
+// panelNames returns the names of all known panels.
+func (d *dashboard) panelNames() []string {
+	names := make([]string, len(d.panels))
+	for i, p := range d.panels {
+		names[i] = p.name
+	}
+	return names
+}
+
+// enable enables exactly the given comma separated list of panels. It
+// returns an error if any of the names is unknown.
+func (d *dashboard) enable(list string) error {
+	want := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			want[name] = true
+		}
+	}
+	for _, p := range d.panels {
+		p.enabled = want[p.name]
+		delete(want, p.name)
+	}
+	for name := range want {
+		return fmt.Errorf("unknown panel %q (known: %s)", name, strings.Join(d.panelNames(), ","))
+	}
+	return nil
+}
+
+// minPanelHeight is the height of a panel's border with a single row inside.
+const minPanelHeight = 3
+
+// setHeights overrides the heights of the panels given as a comma separated
+// list of name=rows pairs, e.g. "gas=24,console=10". It must be called
+// before the layout is built.
+func (d *dashboard) setHeights(list string) error {
+	for _, pair := range strings.Split(list, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		n := strings.Index(pair, "=")
+		if n < 0 {
+			return fmt.Errorf("invalid panel height %q: expected name=rows", pair)
+		}
+		name := strings.TrimSpace(pair[:n])
+		rows, err := strconv.Atoi(strings.TrimSpace(pair[n+1:]))
+		if err != nil || rows < minPanelHeight {
+			return fmt.Errorf("invalid height of panel %s: must be at least %d rows", name, minPanelHeight)
+		}
+		var p *panel
+		for _, q := range d.panels {
+			if q.name == name {
+				p = q
+			}
+		}
+		if p == nil {
+			return fmt.Errorf("unknown panel %q (known: %s)", name, strings.Join(d.panelNames(), ","))
+		}
+		switch p.widget {
+		case d.gas:
+			d.gas.Height, d.gasHeight = rows, rows
+		case d.blockTime:
+			d.blockTime.Height, d.blockTimeHeight = rows, rows
+		case d.console:
+			d.console.setHeight(rows)
+		default:
+			// every panel embeds a termui block, whose height is promoted
+			height := reflect.ValueOf(p.widget).Elem().FieldByName("Height")
+			if !height.IsValid() || !height.CanSet() {
+				return fmt.Errorf("panel %s can't be resized", name)
+			}
+			height.SetInt(int64(rows))
+		}
+	}
+	return nil
+}
+
+// show enables the named panel.
+func (d *dashboard) show(name string) {
+	for _, p := range d.panels {
+		if p.name == name {
+			p.enabled = true
+		}
+	}
+}
+
+// addTab adds a tab with the given comma separated list of panels and
+// enables them. It returns an error if any of the names is unknown.
+func (d *dashboard) addTab(name, list string) error {
+	t := &tab{name: name, panels: make(map[string]bool)}
+	for _, panel := range strings.Split(list, ",") {
+		if panel = strings.TrimSpace(panel); panel == "" {
+			continue
+		}
+		known := false
+		for _, p := range d.panels {
+			if p.name == panel {
+				p.enabled, known = true, true
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown panel %q in tab %s (known: %s)", panel, name, strings.Join(d.panelNames(), ","))
+		}
+		t.panels[panel] = true
+	}
+	d.tabs = append(d.tabs, t)
+	d.labelTabs()
+	return nil
+}
+
+// parseTabs adds the tabs of a semicolon separated list of name=panels
+// definitions, e.g. "fees=gas,gasprice;events=anomalies,console".
+func (d *dashboard) parseTabs(list string) error {
+	for _, def := range strings.Split(list, ";") {
+		if def = strings.TrimSpace(def); def == "" {
+			continue
+		}
+		parts := strings.SplitN(def, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return fmt.Errorf("invalid tab %q, want name=panels", def)
+		}
+		if err := d.addTab(strings.TrimSpace(parts[0]), parts[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// switchTab activates the tab delta positions away from the active one,
+// wrapping around at either end.
+func (d *dashboard) switchTab(delta int) {
+	if len(d.tabs) == 0 {
+		return
+	}
+	d.active = ((d.active+delta)%len(d.tabs) + len(d.tabs)) % len(d.tabs)
+	d.labelTabs()
+}
+
+// labelTabs lists the tabs in the status bar label, marking the active one.
+func (d *dashboard) labelTabs() {
+	names := make([]string, len(d.tabs))
+	for i, t := range d.tabs {
+		names[i] = t.name
+		if i == d.active {
+			names[i] = "[" + t.name + "]"
+		}
+	}
+	d.status.BorderLabel = "Status | " + strings.Join(names, " ")
+}
+
+// visible reports whether the panel is laid out on the active tab.
+func (d *dashboard) visible(p *panel) bool {
+	if !p.enabled {
+		return false
+	}
+	if len(d.tabs) == 0 || p.widget == d.status {
+		return true
+	}
+	return d.tabs[d.active].panels[p.name]
+}
+
+// pause suspends redrawing the dashboard, freezing the display until resume
+// is called. It's safe to call from run.
+func (d *dashboard) pause(reason string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.paused {
+		d.paused, d.pauseReason = true, reason
+	}
+}
+
+// resume continues redrawing the dashboard.
+func (d *dashboard) resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.paused = false
+}
+
+// pauseState returns whether the display is paused and why.
+func (d *dashboard) pauseState() (bool, string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.paused, d.pauseReason
+}
+
+// renderBanner draws the pause banner over the top of the dashboard.
+func (d *dashboard) renderBanner(reason string) {
+	d.banner.Text = "PAUSED: " + reason + " (press p to resume)"
+	d.banner.Width = ui.TermWidth()
+	ui.Render(d.banner)
+}
+
+// reveal requests the named panel to be shown. Unlike show it's safe to call
+// from run; the layout is updated by applyReveals on the UI goroutine.
+func (d *dashboard) reveal(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.revealed = append(d.revealed, name)
+}
+
+// applyReveals shows the panels requested by reveal and reports whether any
+// of them was hidden, in which case the layout has to be rebuilt.
+func (d *dashboard) applyReveals() bool {
+	d.mu.Lock()
+	names := d.revealed
+	d.revealed = nil
+	d.mu.Unlock()
+
+	changed := false
+	for _, name := range names {
+		for _, p := range d.panels {
+			if p.name == name && !p.enabled {
+				p.enabled, changed = true, true
+			}
+		}
+	}
+	return changed
+}
+
+// layout rebuilds ui.Body from the enabled panels. Left and right panels
+// share the top row, the bottom panels each get a full width row.
+func (d *dashboard) layout() {
+	var left, right, bottom, lead []ui.GridBufferer
+	for _, p := range d.panels {
+		if !d.visible(p) {
+			continue
+		}
+		switch p.column {
+		case colTop:
+			lead = append(lead, p.widget)
+		case colLeft:
+			left = append(left, p.widget)
+		case colRight:
+			right = append(right, p.widget)
+		default:
+			bottom = append(bottom, p.widget)
+		}
+	}
+
+	ui.Body.Rows = nil
+	for _, w := range lead {
+		ui.Body.AddRows(ui.NewRow(ui.NewCol(12, 0, w)))
+	}
+
+	var top []*ui.Row
+	switch {
+	case len(left) > 0 && len(right) > 0:
+		top = append(top, ui.NewCol(6, 0, left...), ui.NewCol(6, 0, right...))
+	case len(left) > 0:
+		top = append(top, ui.NewCol(12, 0, left...))
+	case len(right) > 0:
+		top = append(top, ui.NewCol(12, 0, right...))
+	}
+	if len(top) > 0 {
+		ui.Body.AddRows(ui.NewRow(top...))
+	}
+	for _, w := range bottom {
+		ui.Body.AddRows(ui.NewRow(ui.NewCol(12, 0, w)))
+	}
+	ui.Body.Align()
+}
+
+// render draws the dashboard, followed by the popup and the command bar if
+// they are open.
+func (d *dashboard) render() {
+	ui.Render(ui.Body)
+	d.renderOverlays()
+}
+
+// renderOverlays draws the pause banner, the popup and the command bar over
+// the dashboard.
+func (d *dashboard) renderOverlays() {
+	if paused, reason := d.pauseState(); paused {
+		d.renderBanner(reason)
+	}
+	if d.details.visible {
+		ui.Render(d.details)
+	}
+	if d.cmd.active {
+		ui.Render(d.cmd)
+	}
+}
+
+// touch marks the widgets as changed so that they are redrawn on the next
+// call to renderDirty.
+func (d *dashboard) touch(ws ...ui.Bufferer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, w := range ws {
+		d.dirty[w] = true
+	}
+}
+
+// renderDirty redraws only the visible widgets that changed since the last
+// render rather than the whole body. Redrawing a handful of widgets instead
+// of every cell on the screen avoids flicker on slow terminals and saves
+// CPU when nothing changed at all.
+func (d *dashboard) renderDirty() {
+	d.mu.Lock()
+	dirty := d.dirty
+	d.dirty = make(map[ui.Bufferer]bool)
+	d.mu.Unlock()
+
+	if d.console.takeDirty() {
+		dirty[d.console] = true
+	}
+	var ws []ui.Bufferer
+	for _, p := range d.panels {
+		if d.visible(p) && dirty[p.widget] {
+			ws = append(ws, p.widget)
+		}
+	}
+	if len(ws) == 0 {
+		return
+	}
+	ui.Render(ws...)
+
+	// changed widgets are drawn over the overlays, so put them back on top
+	d.renderOverlays()
+}
+
+// minGraphHeight is the height the top graphs shrink to at most.
+const minGraphHeight = 6
+
+// fitConsole expands or shrinks the console with its unread alerts, taking
+// the room from the top graphs of both columns. It reports whether the
+// layout changed.
+func (d *dashboard) fitConsole() bool {
+	extra, changed := d.console.fit()
+	if !changed {
+		return false
+	}
+	shrink := func(base int) int {
+		if h := base - extra; h > minGraphHeight {
+			return h
+		}
+		return minGraphHeight
+	}
+	d.gas.Height = shrink(d.gasHeight)
+	d.blockTime.Height = shrink(d.blockTimeHeight)
+	return true
+}
+
+// handleToggles registers the panel toggle keys.
+func (d *dashboard) handleToggles() {
+	for _, p := range d.panels {
+		p := p
+		d.handleKey(p.key, func() {
+			p.enabled = !p.enabled
+			d.layout()
+			ui.Clear()
+			d.render()
+		})
+	}
+}
+
+// toggleGraphStyles switches all graphs between the bars and the line
+// style.
+func (d *dashboard) toggleGraphStyles() {
+	for _, p := range d.panels {
+		if g, ok := p.widget.(*graph); ok {
+			g.toggleStyle()
+		}
+	}
+}
+
+// handleTabs registers '[' and ']' to switch to the previous and next tab.
+func (d *dashboard) handleTabs() {
+	for key, delta := range map[string]int{"[": -1, "]": 1} {
+		delta := delta
+		d.handleKey(key, func() {
+			d.switchTab(delta)
+			d.layout()
+			ui.Clear()
+			d.render()
+		})
+	}
+}
+
+// handleKey registers fn as the action of the key. While the command bar is
+// open, the key is typed into the bar instead.
+func (d *dashboard) handleKey(key string, fn func()) {
+	ui.Handle("/sys/kbd/"+key, func(ui.Event) {
+		if d.cmd.active {
+			d.typed(key)
+			return
+		}
+		fn()
+	})
+}
+
+// handleCommands registers ':' to open the command bar running the given
+// commands. Keys without an action of their own are only typed into the bar.
+func (d *dashboard) handleCommands(commands map[string]command) {
+	d.commands = commands
+
+	d.handleKey(":", func() {
+		d.cmd.open()
+		d.render()
+	})
+	ui.Handle("/sys/kbd", func(e ui.Event) {
+		if kbd, ok := e.Data.(ui.EvtKbd); ok && d.cmd.active {
+			d.typed(kbd.KeyStr)
+		}
+	})
+}
+
+// typed feeds a key to the open command bar and runs the command once the
+// input is completed.
+func (d *dashboard) typed(key string) {
+	line, done := d.cmd.key(key)
+	if !done {
+		ui.Render(d.cmd)
+		return
+	}
+	ui.Clear()
+	d.render()
+	if line == "" {
+		return
+	}
+	d.console.writeln(":", line)
+	if err := dispatch(line, d.commands); err != nil {
+		d.console.writeln("Command failed: ", err)
+	}
+}
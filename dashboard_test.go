@@ -0,0 +1,29 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import "testing"
+
+func TestSetHeights(t *testing.T) {
+	d := newDashboard()
+	if err := d.setHeights("gas=24, console=10,alerts=5"); err != nil {
+		t.Fatalf("setHeights failed: %v", err)
+	}
+	if d.gas.Height != 24 || d.gasHeight != 24 {
+		t.Errorf("gas graph %d rows (base %d), want 24", d.gas.Height, d.gasHeight)
+	}
+	if d.console.Height != 10 || d.console.baseHeight != 10 {
+		t.Errorf("console %d rows (base %d), want 10", d.console.Height, d.console.baseHeight)
+	}
+	if d.alerts.Height != 5 {
+		t.Errorf("alerts panel %d rows, want 5", d.alerts.Height)
+	}
+
+	for _, list := range []string{"gas", "gas=2", "gas=x", "nosuchpanel=10"} {
+		if err := newDashboard().setHeights(list); err == nil {
+			t.Errorf("setHeights(%q) succeeded, want an error", list)
+		}
+	}
+}
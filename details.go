@@ -0,0 +1,125 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	ui "github.com/gizak/termui"
+)
+
+// detailsPopup is a ui.Par drawn on top of the dashboard showing the
+// details of a single block. It's only accessed from the UI goroutine.
+type detailsPopup struct {
+	*ui.Par
+
+	visible bool
+	header  *types.Header // block currently shown
+	block   *rpcBlock     // full block currently shown, nil if not fetched
+}
+
+func newDetailsPopup() *detailsPopup {
+	par := ui.NewPar("")
+	par.Height = 12
+	par.BorderLabel = "Block details"
+	par.BorderFg = th.popup
+
+	return &detailsPopup{Par: par}
+}
+
+// show opens the popup for the given header, centred on the terminal. The
+// full block is optional and adds the blob transactions, if any.
+func (p *detailsPopup) show(header *types.Header, block *rpcBlock) {
+	p.header, p.block = header, block
+	p.Text = blockDetails(header, block) + "\n\n[d] close  [w] write to file"
+	p.Height = strings.Count(p.Text, "\n") + 3
+	if h := ui.TermHeight(); h < p.Height {
+		p.Height = h
+	}
+	p.Width = 80
+	if w := ui.TermWidth(); w < p.Width {
+		p.Width = w
+	}
+	p.X = (ui.TermWidth() - p.Width) / 2
+	p.Y = (ui.TermHeight() - p.Height) / 2
+	p.visible = true
+}
+
+// blockDetails renders the details of a block as shown in the popup.
+func blockDetails(header *types.Header, block *rpcBlock) string {
+	lines := []string{
+		"number:     " + formatBlockNumber(header.Number),
+		"hash:       " + header.Hash().Hex(),
+		"parent:     " + header.ParentHash.Hex(),
+		"time:       " + time.Unix(header.Time.Int64(), 0).UTC().Format(time.RFC3339),
+		"coinbase:   " + header.Coinbase.Hex(),
+		"builder:    " + builderLabel(header),
+		"gas:        " + gasReadout(header),
+		"difficulty: " + header.Difficulty.String(),
+		fmt.Sprintf("extra:      %q", header.Extra),
+	}
+	if block != nil && block.BaseFee != nil {
+		baseFee := block.BaseFee.ToInt()
+		lines = append(lines,
+			fmt.Sprintf("base fee:   %s gwei (next %s gwei)", formatGwei(baseFee), formatGwei(nextBaseFee(baseFee, uint64(block.GasUsed), uint64(block.GasLimit)))),
+			fmt.Sprintf("burned:     %s ETH", formatEther(burnedFee(baseFee, uint64(block.GasUsed)))))
+	}
+	if block != nil {
+		lines = append(lines, blobDetails(block)...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+const (
+	// blobTxType is the EIP-4844 transaction type.
+	blobTxType = 3
+	// gasPerBlob is the blob gas consumed by every blob.
+	gasPerBlob = 1 << 17
+)
+
+// blobDetails lists the blob transactions of the block along with their
+// versioned hashes. It's empty for blocks without blob transactions.
+func blobDetails(block *rpcBlock) []string {
+	var (
+		lines []string
+		blobs int
+	)
+	for _, tx := range block.Transactions {
+		if tx.Type != blobTxType {
+			continue
+		}
+		blobs += len(tx.BlobHashes)
+		lines = append(lines, fmt.Sprintf("  tx %s: %d blobs, %s blob gas", shortHex(tx.Hash.Hex()), len(tx.BlobHashes), formatHuman(uint64(len(tx.BlobHashes))*gasPerBlob)))
+		for _, hash := range tx.BlobHashes {
+			lines = append(lines, "    "+hash.Hex())
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	blobGas := uint64(blobs) * gasPerBlob
+	if block.BlobGasUsed != nil {
+		blobGas = uint64(*block.BlobGasUsed)
+	}
+	header := fmt.Sprintf("blobs:      %d in %d txs, %s blob gas used", blobs, len(lines)-blobs, formatHuman(blobGas))
+	return append([]string{"", header}, lines...)
+}
+
+// write saves the content of the popup to a timestamped file and returns its
+// name.
+func (p *detailsPopup) write() (string, error) {
+	return writeBlockDetails(p.header, blockDetails(p.header, p.block))
+}
+
+// writeBlockDetails saves the text describing the block to a timestamped
+// file and returns its name.
+func writeBlockDetails(header *types.Header, text string) (string, error) {
+	name := fmt.Sprintf("block-%s-%s.txt", header.Number, time.Now().Format("20060102-150405"))
+	return name, ioutil.WriteFile(name, []byte(text+"\n"), 0644)
+}
@@ -0,0 +1,286 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// loopHistory is the number of recent head hashes remembered to detect
+	// a node re-announcing old blocks.
+	loopHistory = 32
+	// loopThreshold is the number of consecutive re-announced heads after
+	// which the node is considered to be looping.
+	loopThreshold = 3
+)
+
+// loopDetector detects a node that keeps re-announcing the same few blocks
+// rather than advancing. Such a node looks alive when only looking at the
+// arrival of heads, so the detection is based on the hashes.
+type loopDetector struct {
+	seen  map[common.Hash]*announcement // recent hashes
+	order []common.Hash                 // recent hashes, least recently announced first
+
+	repeats   int    // number of consecutive repeated heads
+	low, high uint64 // range of the repeated block numbers
+	warned    bool   // whether the current loop was reported
+}
+
+// announcement is a recent head and the number of times it was announced.
+type announcement struct {
+	number uint64
+	count  int
+}
+
+func newLoopDetector() *loopDetector {
+	return &loopDetector{seen: make(map[common.Hash]*announcement)}
+}
+
+// announcements returns the number of times the head with the hash was
+// announced, 0 if it isn't a recent head.
+func (d *loopDetector) announcements(hash common.Hash) int {
+	if a := d.seen[hash]; a != nil {
+		return a.count
+	}
+	return 0
+}
+
+// observe records the header and reports whether it is a repeat of a recent
+// head. loop is set the first time the repeats exceed loopThreshold, in
+// which case low and high hold the block range the node is looping over.
+func (d *loopDetector) observe(header *types.Header) (repeat, loop bool, low, high uint64) {
+	hash, number := header.Hash(), header.Number.Uint64()
+
+	a, ok := d.seen[hash]
+	if !ok {
+		d.repeats, d.warned = 0, false
+
+		if len(d.order) == loopHistory {
+			delete(d.seen, d.order[0])
+			d.order = d.order[1:]
+		}
+		d.seen[hash] = &announcement{number: number, count: 1}
+		d.order = append(d.order, hash)
+
+		return false, false, 0, 0
+	}
+	// the repeat is counted and kept from ageing out of the history while
+	// the node keeps announcing it
+	a.count++
+	for i, h := range d.order {
+		if h == hash {
+			d.order = append(append(d.order[:i:i], d.order[i+1:]...), hash)
+			break
+		}
+	}
+
+	if d.repeats == 0 || number < d.low {
+		d.low = number
+	}
+	if d.repeats == 0 || number > d.high {
+		d.high = number
+	}
+	d.repeats++
+
+	if d.repeats >= loopThreshold && !d.warned {
+		d.warned = true
+		return true, true, d.low, d.high
+	}
+	return true, false, 0, 0
+}
+
+// timestampRun tracks runs of consecutive blocks reporting the same
+// timestamp, as produced by chains with coarse timestamps or buggy nodes.
+// Block times can't be derived from such timestamps, so the local arrival
+// times of the blocks stand in for them during a run.
+type timestampRun struct {
+	length      int       // number of blocks sharing the timestamp of the run
+	total       int       // number of blocks with a repeated timestamp so far
+	lastArrival time.Time // local arrival time of the previous block
+}
+
+// observe records the arrival of header, which follows last. If both report
+// the same timestamp, identical is set and fallback holds the arrival delta.
+// ended is set, with the length of the run, for the first block after a run.
+func (r *timestampRun) observe(header, last *types.Header, arrival time.Time) (identical bool, fallback time.Duration, ended int) {
+	prevArrival := r.lastArrival
+	r.lastArrival = arrival
+
+	if last == nil || header.Number.Cmp(last.Number) <= 0 || header.Time.Cmp(last.Time) != 0 {
+		ended, r.length = r.length, 0
+		return false, 0, ended
+	}
+	if r.length == 0 {
+		r.length = 1 // the block starting the run
+	}
+	r.length++
+	r.total++
+
+	if !prevArrival.IsZero() {
+		fallback = arrival.Sub(prevArrival)
+	}
+	return true, fallback, 0
+}
+
+// parseGasLevels parses a comma separated list of gas limit levels, e.g.
+// "30M,36M".
+func parseGasLevels(list string) ([]uint64, error) {
+	var levels []uint64
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		level, err := parseHuman(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gas limit level: %v", err)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+// gasLimitCrossing returns the level the gas limit crossed when changing
+// from prev to cur. Reaching a level counts as crossing it, so does leaving
+// it downwards. up tells the direction.
+func gasLimitCrossing(levels []uint64, prev, cur uint64) (level uint64, up, ok bool) {
+	for _, l := range levels {
+		switch {
+		case prev < l && cur >= l:
+			return l, true, true
+		case prev >= l && cur < l:
+			return l, false, true
+		}
+	}
+	return 0, false, false
+}
+
+// gasLimitBoundDivisor bounds the change of the gas limit between a block
+// and its parent to less than 1/1024 of the parent's gas limit.
+const gasLimitBoundDivisor = 1024
+
+// londonBlocks are the London fork blocks of the known chains by chain ID.
+// Chains forking at genesis need no entry.
+var londonBlocks = map[uint64]uint64{
+	1: 12965000, // mainnet
+	3: 10499401, // ropsten
+	4: 8897988,  // rinkeby
+	5: 5062605,  // goerli
+}
+
+// londonBlock returns the London fork block of the chain, or nil if the
+// chain isn't known.
+func londonBlock(chainID *big.Int) *big.Int {
+	if chainID == nil || !chainID.IsUint64() {
+		return nil
+	}
+	if number, ok := londonBlocks[chainID.Uint64()]; ok {
+		return new(big.Int).SetUint64(number)
+	}
+	return nil
+}
+
+// gasLimitOutOfBounds reports whether the gas limit changed from parent to
+// cur by more than the protocol allows. The London fork block doubles the
+// parent gas limit before applying the bound, so there the bound applies
+// to twice the parent's limit instead.
+func gasLimitOutOfBounds(parent, cur uint64, london bool) bool {
+	if london {
+		parent *= 2
+	}
+	diff := cur - parent
+	if cur < parent {
+		diff = parent - cur
+	}
+	return diff >= parent/gasLimitBoundDivisor
+}
+
+// gasLimitObserver alerts about gas limit changes beyond the protocol bound
+// and about the gas limit crossing one of the notable levels, which it
+// flags in the state for the gas graph. It's only accessed from run.
+type gasLimitObserver struct {
+	levels  []uint64
+	london  *big.Int // London fork block, nil if unknown
+	console *console
+}
+
+func newGasLimitObserver(levels []uint64, london *big.Int, console *console) *gasLimitObserver {
+	return &gasLimitObserver{levels: levels, london: london, console: console}
+}
+
+func (o *gasLimitObserver) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	if state.parent == nil {
+		return
+	}
+	prev, cur := state.parent.GasLimit.Uint64(), header.GasLimit.Uint64()
+	london := o.london != nil && header.Number.Cmp(o.london) == 0
+	if header.ParentHash == state.parent.Hash() && gasLimitOutOfBounds(prev, cur, london) {
+		o.console.alert(levelWarn, fmt.Sprintf("gas limit of block %s changed beyond the 1/%d bound (%d -> %d)",
+			formatBlockNumber(header.Number), gasLimitBoundDivisor, prev, cur))
+	}
+	if level, up, ok := gasLimitCrossing(o.levels, prev, cur); ok {
+		direction := "below"
+		if up {
+			direction = "above"
+		}
+		o.console.writeln(th.mark(levelGood, fmt.Sprintf("Gas limit moved %s %s at block %s (%s -> %s)",
+			direction, formatHuman(level), formatBlockNumber(header.Number), formatHuman(prev), formatHuman(cur))))
+		state.crossed = true
+	}
+}
+
+// driftSamples is the number of recent heads the clock drift is the median
+// of, so that a single late head doesn't count as drift.
+const driftSamples = 10
+
+// driftDetector tracks the difference between the local arrival time of
+// heads and their timestamps. Propagation makes heads arrive a little after
+// their timestamp; a median beyond the threshold, or heads from the future,
+// point at a misconfigured clock on either end.
+type driftDetector struct {
+	threshold time.Duration
+	samples   []float64 // recent drifts in seconds
+	drifting  bool      // whether the drift is currently beyond the threshold
+}
+
+func newDriftDetector(threshold time.Duration) *driftDetector {
+	return &driftDetector{threshold: threshold}
+}
+
+// observe records the drift of a head arriving at the given time. It returns
+// the median drift and whether it just crossed the threshold in either
+// direction.
+func (d *driftDetector) observe(header *types.Header, arrival time.Time) (drift time.Duration, started, ended bool) {
+	sample := arrival.Sub(time.Unix(header.Time.Int64(), 0)).Seconds()
+	if len(d.samples) == driftSamples {
+		d.samples = d.samples[1:]
+	}
+	d.samples = append(d.samples, sample)
+
+	drift = time.Duration(medianFloat(d.samples) * float64(time.Second))
+	drifting := drift > d.threshold || drift < -d.threshold
+	started, ended = drifting && !d.drifting, !drifting && d.drifting
+	d.drifting = drifting
+	return drift, started, ended
+}
+
+// driftLevel grades the clock drift: small positive drift is propagation,
+// heads from the future or drift beyond the threshold are bad.
+func driftLevel(drift, threshold time.Duration) level {
+	switch {
+	case drift > threshold || drift < -threshold:
+		return levelBad
+	case drift < 0 || drift > threshold/2:
+		return levelWarn
+	}
+	return levelGood
+}
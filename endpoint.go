@@ -0,0 +1,257 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Transports a node endpoint can be reached over.
+const (
+	transportIPC  = "ipc"
+	transportHTTP = "http"
+	transportWS   = "ws"
+)
+
+// isWindowsPipe reports whether the endpoint is a Windows named pipe, e.g.
+// \\.\pipe\geth.ipc.
+func isWindowsPipe(endpoint string) bool {
+	return strings.HasPrefix(endpoint, `\\.\pipe\`) || strings.HasPrefix(endpoint, `//./pipe/`)
+}
+
+// isDrivePath reports whether the endpoint is a path starting with a Windows
+// drive letter, e.g. C:\geth\geth.ipc, which would otherwise parse as a URL
+// with the scheme "c".
+func isDrivePath(endpoint string) bool {
+	if len(endpoint) < 3 || endpoint[1] != ':' || (endpoint[2] != '\\' && endpoint[2] != '/') {
+		return false
+	}
+	c := endpoint[0]
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// ipcScheme explicitly marks an endpoint as an IPC path, e.g.
+// ipc:///run/geth.ipc, for paths that would otherwise be ambiguous.
+const ipcScheme = "ipc://"
+
+// ipcPath returns the path of an IPC endpoint without its ipc:// prefix.
+func ipcPath(endpoint string) string {
+	if strings.HasPrefix(strings.ToLower(endpoint), ipcScheme) {
+		return endpoint[len(ipcScheme):]
+	}
+	return endpoint
+}
+
+// hostPort matches endpoints like localhost:8545 that were meant as URLs.
+var hostPort = regexp.MustCompile(`^[\w.-]+:\d+$`)
+
+// checkSocket reports a clear error unless path is an existing socket.
+// Windows named pipes can't be inspected and are left to the dialer.
+func checkSocket(path string) error {
+	if isWindowsPipe(path) {
+		return nil
+	}
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err) && hostPort.MatchString(path):
+		return fmt.Errorf("invalid endpoint %s: no such IPC socket, add a scheme if it's a URL, e.g. http://%s", path, path)
+	case os.IsNotExist(err):
+		return fmt.Errorf("invalid endpoint %s: no such IPC socket, and not a URL with an http, https, ws, wss or ipc scheme", path)
+	case err != nil:
+		return fmt.Errorf("invalid endpoint %s: %v", path, err)
+	case info.Mode()&os.ModeSocket == 0 && !isDrivePath(path):
+		return fmt.Errorf("invalid endpoint %s: not a socket", path)
+	}
+	return nil
+}
+
+// endpointTransport detects the transport of the endpoint. Endpoints with an
+// http, https, ws or wss scheme are URLs, which may carry IPv6 literals in
+// brackets and basic auth credentials. Anything else must be an existing
+// IPC socket, optionally prefixed with ipc://.
+func endpointTransport(endpoint string) (string, error) {
+	if isWindowsPipe(endpoint) || isDrivePath(endpoint) || !strings.Contains(endpoint, "://") {
+		if err := checkSocket(endpoint); err != nil {
+			return "", err
+		}
+		return transportIPC, nil
+	}
+	if path := ipcPath(endpoint); path != endpoint {
+		if err := checkSocket(path); err != nil {
+			return "", err
+		}
+		return transportIPC, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		if strings.Count(endpoint, ":") > 2 && !strings.Contains(endpoint, "[") {
+			return "", fmt.Errorf("invalid endpoint %s: IPv6 addresses must be enclosed in brackets, e.g. ws://[::1]:8546", redactEndpoint(endpoint))
+		}
+		return "", fmt.Errorf("invalid endpoint %s: %v", redactEndpoint(endpoint), err)
+	}
+	if strings.Count(u.Host, ":") > 1 && !strings.Contains(u.Host, "[") {
+		return "", fmt.Errorf("invalid endpoint %s: IPv6 addresses must be enclosed in brackets, e.g. ws://[::1]:8546", redactEndpoint(endpoint))
+	}
+	if u.Hostname() == "" {
+		return "", fmt.Errorf("invalid endpoint %s: missing host", redactEndpoint(endpoint))
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return transportHTTP, nil
+	case "ws", "wss":
+		return transportWS, nil
+	}
+	return "", fmt.Errorf("invalid endpoint %s: unknown scheme %q (known: http, https, ws, wss, ipc)", redactEndpoint(endpoint), u.Scheme)
+}
+
+// insecureTLS disables the verification of TLS certificates of https and
+// wss endpoints, e.g. for dev nodes with self-signed certificates. It's set
+// with the -insecure flag.
+var insecureTLS bool
+
+// skipTLSVerify disables the certificate verification of the default HTTP
+// transport, which the HTTP client of go-ethereum dials with. Other clients
+// on the default transport, such as the rule webhook, are affected as well.
+func skipTLSVerify() {
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+}
+
+// tunnelDialTimeout bounds the TLS handshake of a tunnelled connection.
+const tunnelDialTimeout = 10 * time.Second
+
+// insecureTunnel forwards the connections accepted on a loopback listener
+// to the TLS endpoint at addr, without verifying its certificate. The
+// websocket client of go-ethereum takes no TLS config, so with -insecure it
+// dials the tunnel instead of a wss endpoint. The listener stays open for
+// the reconnects of the client.
+func insecureTunnel(addr, serverName string) (net.Listener, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go forwardTLS(conn, addr, serverName)
+		}
+	}()
+	return l, nil
+}
+
+// forwardTLS copies between conn and a TLS connection to addr until either
+// side closes.
+func forwardTLS(conn net.Conn, addr, serverName string) {
+	defer conn.Close()
+
+	dialer := &net.Dialer{Timeout: tunnelDialTimeout}
+	remote, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(remote, conn); done <- struct{}{} }()
+	go func() { io.Copy(conn, remote); done <- struct{}{} }()
+	<-done
+}
+
+// dialInsecureWebsocket connects to a wss endpoint through an insecureTunnel.
+// The handshake carries the tunnel address as its Host header, which is fine
+// for dev nodes but not for virtual hosts routing on it.
+func dialInsecureWebsocket(ctx context.Context, endpoint string) (*rpc.Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "443")
+	}
+	l, err := insecureTunnel(addr, u.Hostname())
+	if err != nil {
+		return nil, err
+	}
+	local := *u
+	local.Scheme, local.Host = "ws", l.Addr().String()
+	client, err := rpc.DialWebsocket(ctx, local.String(), "")
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// dialEndpoint connects to the node over the transport of the endpoint.
+func dialEndpoint(ctx context.Context, endpoint string) (*rpc.Client, error) {
+	transport, err := endpointTransport(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	switch transport {
+	case transportHTTP:
+		// -insecure applies through the default transport
+		return rpc.DialHTTP(endpoint)
+	case transportWS:
+		if insecureTLS && strings.HasPrefix(strings.ToLower(endpoint), "wss:") {
+			return dialInsecureWebsocket(ctx, endpoint)
+		}
+		return rpc.DialWebsocket(ctx, endpoint, "")
+	}
+	return rpc.DialIPC(ctx, ipcPath(endpoint))
+}
+
+// redactError returns the message of an error of a request to the endpoint
+// with the password hidden, as errors of the RPC client and net/url quote
+// the endpoint.
+func redactError(err error, endpoint string) string {
+	msg := strings.Replace(err.Error(), endpoint, redactEndpoint(endpoint), -1)
+	if u, perr := url.Parse(endpoint); perr == nil && u.User != nil {
+		// quoted in parts, e.g. the escaped form in a url.Error
+		if password, ok := u.User.Password(); ok && password != "" {
+			msg = strings.Replace(msg, password, "xxxxx", -1)
+			msg = strings.Replace(msg, url.QueryEscape(password), "xxxxx", -1)
+		}
+	}
+	return msg
+}
+
+// redactEndpoint hides the password of URL endpoints so that they can be
+// shown and logged.
+func redactEndpoint(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		return endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		// don't echo what might be credentials in a URL we can't parse
+		if i := strings.LastIndex(endpoint, "@"); i >= 0 {
+			return endpoint[:strings.Index(endpoint, "://")+3] + "xxxxx" + endpoint[i:]
+		}
+		return endpoint
+	}
+	if u.User == nil {
+		return endpoint
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
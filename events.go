@@ -0,0 +1,174 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockEvent is the JSON event emitted for every processed block, one per
+// line, to the consumers of the live feed.
+type blockEvent struct {
+	Number      uint64  `json:"number"`
+	Hash        string  `json:"hash"`
+	ParentHash  string  `json:"parentHash"`
+	Time        uint64  `json:"time"`
+	GasLimit    uint64  `json:"gasLimit"`
+	GasUsed     uint64  `json:"gasUsed"`
+	Utilisation float64 `json:"utilisation"`
+	BaseFee     string  `json:"baseFee,omitempty"` // wei, requires -fetch
+	Txs         *int    `json:"txs,omitempty"`     // requires -fetch
+}
+
+// newBlockEvent creates the event of a block. The full block is optional.
+func newBlockEvent(header *types.Header, block *rpcBlock) *blockEvent {
+	event := &blockEvent{
+		Number:      header.Number.Uint64(),
+		Hash:        header.Hash().Hex(),
+		ParentHash:  header.ParentHash.Hex(),
+		Time:        header.Time.Uint64(),
+		GasLimit:    header.GasLimit.Uint64(),
+		GasUsed:     header.GasUsed.Uint64(),
+		Utilisation: utilisation(header),
+	}
+	if block != nil {
+		txs := len(block.Transactions)
+		event.Txs = &txs
+		if block.BaseFee != nil {
+			event.BaseFee = block.BaseFee.ToInt().String()
+		}
+	}
+	return event
+}
+
+// eventQueue is the number of events buffered per socket client. Clients
+// falling further behind are disconnected rather than slowing down run.
+const eventQueue = 64
+
+// eventWriteTimeout is the time a client has to take an event. A client not
+// reading at all is dropped after it, rather than blocking its writer for
+// good once the socket buffer is full.
+const eventWriteTimeout = 5 * time.Second
+
+// eventSocket mirrors the block events to every client connected to a Unix
+// domain socket.
+type eventSocket struct {
+	path     string
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[net.Conn]chan []byte
+}
+
+// listenEvents creates the Unix domain socket at path, replacing a stale
+// socket file left behind by an earlier run.
+func listenEvents(path string) (*eventSocket, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &eventSocket{path: path, listener: l, clients: make(map[net.Conn]chan []byte)}, nil
+}
+
+// serve accepts clients until the socket is closed.
+func (s *eventSocket) serve(console *console) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		queue := make(chan []byte, eventQueue)
+		s.mu.Lock()
+		s.clients[conn] = queue
+		s.mu.Unlock()
+
+		console.writeln("Event socket: client connected")
+		go s.write(conn, queue, console)
+	}
+}
+
+// write sends the queued events to the client until it disconnects or is
+// dropped for falling behind.
+func (s *eventSocket) write(conn net.Conn, queue chan []byte, console *console) {
+	defer conn.Close()
+	for line := range queue {
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := conn.Write(line); err != nil {
+			s.drop(conn)
+			if err, ok := err.(net.Error); ok && err.Timeout() {
+				console.alert(levelWarn, fmt.Sprintf("Event socket: dropped a client not reading within %v", eventWriteTimeout))
+			} else {
+				console.writeln("Event socket: client disconnected")
+			}
+			return
+		}
+	}
+	console.alert(levelWarn, "Event socket: dropped a client falling behind")
+}
+
+// drop removes the client, closing its queue if it's still registered.
+func (s *eventSocket) drop(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if queue, ok := s.clients[conn]; ok {
+		delete(s.clients, conn)
+		close(queue)
+	}
+}
+
+// publish queues the event for all clients without blocking. It's nil safe
+// so that run can publish unconditionally.
+func (s *eventSocket) publish(event *blockEvent) {
+	if s == nil {
+		return
+	}
+	blob, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	line := append(blob, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, queue := range s.clients {
+		select {
+		case queue <- line:
+		default:
+			delete(s.clients, conn)
+			close(queue)
+		}
+	}
+}
+
+// Close stops accepting clients, disconnects the connected ones and removes
+// the socket file.
+func (s *eventSocket) Close() error {
+	if s == nil {
+		return nil
+	}
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn, queue := range s.clients {
+		delete(s.clients, conn)
+		close(queue)
+	}
+	s.mu.Unlock()
+
+	os.Remove(s.path)
+	return err
+}
@@ -0,0 +1,164 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	ui "github.com/gizak/termui"
+)
+
+// extreme is the highest or lowest value a metric reached during the
+// session along with the block it was reached in.
+type extreme struct {
+	metric string
+	low    bool // whether it's the lowest rather than the highest value
+	value  float64
+	header *types.Header
+}
+
+// observeExtremes accounts the metrics of a block against the session
+// extremes. The header is kept so that the details of the block can be
+// shown long after it left the recent history.
+func (s *session) observeExtremes(header *types.Header, metrics map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.highs == nil {
+		s.highs, s.lows = make(map[string]*extreme), make(map[string]*extreme)
+	}
+	for metric, v := range metrics {
+		if e := s.highs[metric]; e == nil || v > e.value {
+			s.highs[metric] = &extreme{metric: metric, value: v, header: header}
+		}
+		if e := s.lows[metric]; e == nil || v < e.value {
+			s.lows[metric] = &extreme{metric: metric, low: true, value: v, header: header}
+		}
+	}
+}
+
+// allExtremes returns the session extremes in the order of ruleMetrics, the
+// highest value of each metric followed by its lowest.
+func (s *session) allExtremes() []extreme {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var extremes []extreme
+	for _, metric := range ruleMetrics {
+		if e := s.highs[metric]; e != nil {
+			extremes = append(extremes, *e)
+		}
+		if e := s.lows[metric]; e != nil {
+			extremes = append(extremes, *e)
+		}
+	}
+	return extremes
+}
+
+// extremeLabels holds the labels of the highest and the lowest value of
+// each metric.
+var extremeLabels = map[string][2]string{
+	metricUtilisation: {"highest gas used", "lowest gas used"},
+	metricGasUsed:     {"largest block", "smallest block"},
+	metricGasLimit:    {"highest gas limit", "lowest gas limit"},
+	metricBlockTime:   {"longest block time", "shortest block time"},
+	metricBaseFee:     {"highest base fee", "lowest base fee"},
+	metricTxs:         {"most transactions", "fewest transactions"},
+}
+
+// extremeText describes an extreme in the unit of its metric.
+func extremeText(e extreme) string {
+	label, value := e.metric, formatFloat(e.value)
+	if labels, ok := extremeLabels[e.metric]; ok {
+		label = labels[0]
+		if e.low {
+			label = labels[1]
+		}
+	}
+	switch e.metric {
+	case metricUtilisation:
+		value += "%"
+	case metricGasUsed:
+		value = formatHuman(uint64(e.value)) + " gas"
+	case metricGasLimit:
+		value = formatHuman(uint64(e.value))
+	case metricBlockTime:
+		value += "s"
+	case metricBaseFee:
+		value += " gwei"
+	case metricTxs:
+		value = fmt.Sprintf("%.0f", e.value)
+	}
+	return fmt.Sprintf("%-20s %s", label+":", value)
+}
+
+// extremesPanel lists the session extremes. It's updated from the timer and
+// navigated from the key handlers, which termui runs on separate
+// goroutines, so all access goes through mu.
+type extremesPanel struct {
+	*ui.List
+
+	mu       sync.Mutex
+	extremes []extreme
+	selected int // index of the selected extreme, -1 if none
+}
+
+func newExtremesPanel() *extremesPanel {
+	list := ui.NewList()
+	list.Height = 2*len(ruleMetrics) + 2
+	list.BorderLabel = "Session extremes (x to inspect)"
+	list.Items = []string{"waiting for first head..."}
+
+	return &extremesPanel{List: list, selected: -1}
+}
+
+// Buffer renders the list while holding the panel lock.
+func (p *extremesPanel) Buffer() ui.Buffer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.List.Buffer()
+}
+
+// update renders the extremes into the list, highlighting the selection.
+func (p *extremesPanel) update(extremes []extreme) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.render(extremes)
+}
+
+func (p *extremesPanel) render(extremes []extreme) {
+	p.extremes = extremes
+	if p.selected >= len(extremes) {
+		p.selected = -1
+	}
+	if len(extremes) == 0 {
+		return
+	}
+	items := make([]string, len(extremes))
+	for i, e := range extremes {
+		items[i] = fmt.Sprintf("%s at %s", extremeText(e), formatBlockNumber(e.header.Number))
+		if i == p.selected {
+			items[i] = fmt.Sprintf("[%s](fg-black,bg-white)", items[i])
+		}
+	}
+	p.Items = items
+}
+
+// next selects the next extreme, wrapping around, and returns its block.
+func (p *extremesPanel) next() (*types.Header, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.extremes) == 0 {
+		return nil, false
+	}
+	p.selected = (p.selected + 1) % len(p.extremes)
+	p.render(p.extremes)
+	return p.extremes[p.selected].header, true
+}
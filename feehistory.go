@@ -0,0 +1,110 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	ui "github.com/gizak/termui"
+)
+
+// feeHistory is the response of eth_feeHistory. The node computes the
+// reward percentiles itself, so the panel needs neither full blocks nor
+// receipts.
+type feeHistory struct {
+	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
+	BaseFee      []*hexutil.Big   `json:"baseFeePerGas"` // one more than blocks, the last is the next block's
+	GasUsedRatio []float64        `json:"gasUsedRatio"`
+	Reward       [][]*hexutil.Big `json:"reward"` // per block, one per requested percentile
+}
+
+// fetchFeeHistory requests the fee history of the latest blocks at the
+// given reward percentiles.
+func fetchFeeHistory(ctx context.Context, client *rpc.Client, blocks int, pcts []float64) (*feeHistory, error) {
+	var hist feeHistory
+	if err := client.CallContext(ctx, &hist, "eth_feeHistory", hexutil.Uint64(blocks), "latest", pcts); err != nil {
+		return nil, err
+	}
+	if len(hist.BaseFee) == 0 {
+		return nil, fmt.Errorf("empty fee history")
+	}
+	return &hist, nil
+}
+
+// maxFeeHistory is the most blocks nodes such as geth return from
+// eth_feeHistory in a single request.
+const maxFeeHistory = 1024
+
+// feeHistoryLineHeight is the height of every line of the fee history
+// graph, not counting its title.
+const feeHistoryLineHeight = 2
+
+// newFeeHistoryGraph returns the fee history graph with its base fee line.
+// It's revealed once the node answered eth_feeHistory.
+func newFeeHistoryGraph() *ui.Sparklines {
+	base := ui.Sparkline{}
+	base.Height = feeHistoryLineHeight
+	base.Title = "Base fee"
+	base.LineColor = th.gasPrice
+	base.TitleColor = th.title
+
+	sp := ui.NewSparklines(base)
+	sp.Height = feeHistoryLineHeight + 3
+	sp.BorderLabel = "Fee history (eth_feeHistory)"
+
+	return sp
+}
+
+// addRewardLines adds a line per reward percentile below the base fee line,
+// growing the graph to fit them.
+func addRewardLines(sp *ui.Sparklines, pcts []float64) {
+	for _, p := range pcts {
+		spark := ui.Sparkline{}
+		spark.Height = feeHistoryLineHeight
+		spark.Title = fmt.Sprintf("p%s reward", formatFloat(p))
+		spark.LineColor = th.accentColor
+		spark.TitleColor = th.title
+		sp.Add(spark)
+	}
+	sp.Height = len(sp.Lines)*(feeHistoryLineHeight+1) + 2
+}
+
+// updateFeeHistoryGraph renders the base fees and rewards of the history in
+// mwei, titled with the values of the newest block.
+func updateFeeHistoryGraph(sp *ui.Sparklines, hist *feeHistory, pcts []float64) {
+	blocks := len(hist.GasUsedRatio)
+	if blocks > len(hist.BaseFee) {
+		blocks = len(hist.BaseFee)
+	}
+	base := make([]int, blocks)
+	for i := range base {
+		base[i] = sampleValue(hist.BaseFee[i].ToInt(), mwei)
+	}
+	sp.Lines[0].Data = base
+	next := hist.BaseFee[len(hist.BaseFee)-1].ToInt()
+	sp.Lines[0].Title = fmt.Sprintf("Base fee: next %s gwei", formatGwei(next))
+
+	for j := range pcts {
+		rewards := make([]int, 0, len(hist.Reward))
+		var last *big.Int
+		for _, r := range hist.Reward {
+			if j < len(r) && r[j] != nil {
+				last = r[j].ToInt()
+				rewards = append(rewards, sampleValue(last, mwei))
+			}
+		}
+		sp.Lines[j+1].Data = rewards
+		if last != nil {
+			sp.Lines[j+1].Title = fmt.Sprintf("p%s reward: %s gwei", formatFloat(pcts[j]), formatGwei(last))
+		}
+	}
+	if hist.OldestBlock != nil {
+		sp.BorderLabel = fmt.Sprintf("Fee history (eth_feeHistory) of %d blocks from %s", blocks, formatBlockNumber(hist.OldestBlock.ToInt()))
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// rpcBlock is a block including its full transactions as returned by
+// eth_getBlockByHash. Blocks are decoded from the raw RPC response rather
+// than into types.Block so that fields of newer block and transaction
+// formats are available.
+type rpcBlock struct {
+	Number       *hexutil.Big      `json:"number"`
+	Hash         common.Hash       `json:"hash"`
+	GasLimit     hexutil.Uint64    `json:"gasLimit"`
+	GasUsed      hexutil.Uint64    `json:"gasUsed"`
+	Time         hexutil.Uint64    `json:"timestamp"`
+	BaseFee      *hexutil.Big      `json:"baseFeePerGas"`
+	BlobGasUsed  *hexutil.Uint64   `json:"blobGasUsed"`
+	Transactions []*rpcTransaction `json:"transactions"`
+	Withdrawals  []*rpcWithdrawal  `json:"withdrawals"`
+}
+
+// rpcTransaction is a transaction as contained in an rpcBlock.
+type rpcTransaction struct {
+	Hash     common.Hash     `json:"hash"`
+	From     common.Address  `json:"from"`
+	To       *common.Address `json:"to"`
+	Gas      hexutil.Uint64  `json:"gas"`
+	GasPrice *hexutil.Big    `json:"gasPrice"`
+
+	Type       hexutil.Uint64 `json:"type"`
+	BlobHashes []common.Hash  `json:"blobVersionedHashes"`
+}
+
+// rpcWithdrawal is a beacon chain withdrawal as contained in an rpcBlock.
+type rpcWithdrawal struct {
+	Index     hexutil.Uint64 `json:"index"`
+	Validator hexutil.Uint64 `json:"validatorIndex"`
+	Address   common.Address `json:"address"`
+	Amount    hexutil.Uint64 `json:"amount"` // in gwei
+}
+
+// rpcReceipt is a transaction receipt as returned by eth_getBlockReceipts and
+// eth_getTransactionReceipt.
+type rpcReceipt struct {
+	TxHash            common.Hash    `json:"transactionHash"`
+	GasUsed           hexutil.Uint64 `json:"gasUsed"`
+	EffectiveGasPrice *hexutil.Big   `json:"effectiveGasPrice"`
+	Status            hexutil.Uint64 `json:"status"`
+}
+
+// blockData is everything fetched for a single block.
+type blockData struct {
+	block    *rpcBlock
+	receipts []*rpcReceipt // nil unless receipts were requested
+}
+
+var errBlockNotFound = errors.New("block not found")
+
+// fetcher retrieves the per block data required by the enabled features.
+// All requests for a block are sent as a single batch. Nodes that don't
+// support batching are queried with sequential calls instead.
+type fetcher struct {
+	client   *rpc.Client
+	receipts bool // whether receipts are fetched along with the block
+
+	noBatch bool // set once the node failed a batch request
+
+	cache map[common.Hash]*blockData // recently fetched blocks
+	order []common.Hash              // cached hashes in insertion order
+}
+
+// fetchCacheSize is the number of fetched blocks kept in memory so that
+// views showing the same block don't fetch it again.
+const fetchCacheSize = 16
+
+func newFetcher(client *rpc.Client, receipts bool) *fetcher {
+	return &fetcher{
+		client:   client,
+		receipts: receipts,
+		cache:    make(map[common.Hash]*blockData),
+	}
+}
+
+// fetch retrieves the block with the given hash including all of its
+// transactions and, if enabled, their receipts. Recently fetched blocks are
+// served from the cache.
+func (f *fetcher) fetch(ctx context.Context, hash common.Hash) (*blockData, error) {
+	if data, ok := f.cache[hash]; ok {
+		return data, nil
+	}
+	data, err := f.fetchBatch(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.order) == fetchCacheSize {
+		delete(f.cache, f.order[0])
+		f.order = f.order[1:]
+	}
+	f.cache[hash] = data
+	f.order = append(f.order, hash)
+
+	return data, nil
+}
+
+func (f *fetcher) fetchBatch(ctx context.Context, hash common.Hash) (*blockData, error) {
+	var (
+		data  = new(blockData)
+		batch = []rpc.BatchElem{{
+			Method: "eth_getBlockByHash",
+			Args:   []interface{}{hash, true},
+			Result: &data.block,
+		}}
+	)
+	if f.receipts {
+		batch = append(batch, rpc.BatchElem{
+			Method: "eth_getBlockReceipts",
+			Args:   []interface{}{hash},
+			Result: &data.receipts,
+		})
+	}
+	if err := f.call(ctx, batch); err != nil {
+		return nil, err
+	}
+	if batch[0].Error != nil {
+		return nil, batch[0].Error
+	}
+	if data.block == nil {
+		return nil, errBlockNotFound
+	}
+	// fall back to per transaction receipts on nodes without
+	// eth_getBlockReceipts
+	if f.receipts && (batch[1].Error != nil || len(data.receipts) != len(data.block.Transactions)) {
+		receipts, err := f.fetchReceipts(ctx, data.block)
+		if err != nil {
+			return nil, err
+		}
+		data.receipts = receipts
+	}
+	return data, nil
+}
+
+// fetchReceipts retrieves the receipts of all transactions in the block.
+func (f *fetcher) fetchReceipts(ctx context.Context, block *rpcBlock) ([]*rpcReceipt, error) {
+	var (
+		receipts = make([]*rpcReceipt, len(block.Transactions))
+		batch    = make([]rpc.BatchElem, len(block.Transactions))
+	)
+	for i, tx := range block.Transactions {
+		batch[i] = rpc.BatchElem{
+			Method: "eth_getTransactionReceipt",
+			Args:   []interface{}{tx.Hash},
+			Result: &receipts[i],
+		}
+	}
+	if err := f.call(ctx, batch); err != nil {
+		return nil, err
+	}
+	for i := range batch {
+		if batch[i].Error != nil {
+			return nil, batch[i].Error
+		}
+		if receipts[i] == nil {
+			return nil, fmt.Errorf("receipt of %x not found", block.Transactions[i].Hash)
+		}
+	}
+	return receipts, nil
+}
+
+// call sends the requests as a batch, or one by one if the node doesn't
+// support batching.
+func (f *fetcher) call(ctx context.Context, batch []rpc.BatchElem) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	if !f.noBatch {
+		err := f.client.BatchCallContext(ctx, batch)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+		f.noBatch = true
+	}
+	for i := range batch {
+		batch[i].Error = f.client.CallContext(ctx, batch[i].Result, batch[i].Method, batch[i].Args...)
+	}
+	return nil
+}
+
+// txGasEfficiency returns the average gas limit and the average gas used per
+// transaction of the block. ok is false for blocks without transactions.
+func txGasEfficiency(block *rpcBlock) (avgLimit, avgUsed float64, ok bool) {
+	n := len(block.Transactions)
+	if n == 0 {
+		return 0, 0, false
+	}
+	var limit uint64
+	for _, tx := range block.Transactions {
+		limit += uint64(tx.Gas)
+	}
+	return float64(limit) / float64(n), float64(block.GasUsed) / float64(n), true
+}
+
+// fetchObserver fetches the full block of every head for the per
+// transaction panels. It sets the block, its base fee and the transaction
+// count and base fee metrics for the observers registered after it. It's
+// only accessed from run.
+type fetchObserver struct {
+	dash      *dashboard
+	sess      *session
+	fetch     *fetcher
+	receipts  bool // whether receipts are fetched for the top tx and gas price panels
+	withdrawn *withdrawalTracker
+	fees      *feePercentiles // nil unless fee percentiles are listed
+	corr      *correlations
+	sample    *sampler
+
+	txs      []int // transactions per graph point
+	baseFees []int // base fee in mwei
+	gasPrice []int // gas weighted price in mwei
+	txShare  []int // percentage of gas used by the largest tx
+}
+
+func newFetchObserver(dash *dashboard, sess *session, client *rpc.Client, cfg *config, corr *correlations) *fetchObserver {
+	o := &fetchObserver{
+		dash:      dash,
+		sess:      sess,
+		fetch:     newFetcher(client, cfg.receipts),
+		receipts:  cfg.receipts,
+		withdrawn: newWithdrawalTracker(cfg.recipientNames),
+		corr:      corr,
+		sample:    newSampler(cfg.sampleSize, cfg.sampleSpan),
+	}
+	if len(cfg.feePercentiles) > 0 {
+		o.fees = newFeePercentiles(cfg.feePercentiles)
+	}
+	return o
+}
+
+func (o *fetchObserver) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	data, err := o.fetch.fetch(ctx, header.Hash())
+	if err != nil {
+		o.dash.console.alert(levelBad, fmt.Sprint("failed to fetch block: ", err))
+		return
+	}
+	// the base fee follows from the gas used by the parent
+	var parentGas *big.Int
+	if state.parent != nil && header.ParentHash == state.parent.Hash() {
+		parentGas = state.parent.GasUsed
+	}
+	o.observe(data, parentGas, state)
+}
+
+// observe feeds the panels with a fetched block. parentGas is the gas used
+// by its parent, nil if the parent wasn't seen.
+func (o *fetchObserver) observe(data *blockData, parentGas *big.Int, state *blockState) {
+	block := data.block
+	state.block = block
+	o.sess.setBlock(block)
+	state.metrics[metricTxs] = float64(len(block.Transactions))
+	o.sample.addTxs(len(block.Transactions))
+	if o.sample.addBlock(uint64(block.Time)) {
+		o.txs = pushSample(o.txs, o.sample.flush().txs)
+		o.sess.record("Transactions", o.txs)
+	}
+
+	o.withdrawn.add(block)
+	o.withdrawn.update(o.dash.withdraw)
+	o.dash.touch(o.dash.withdraw)
+	if o.fees != nil {
+		o.fees.add(data)
+		o.fees.update(o.dash.fees)
+		o.dash.touch(o.dash.fees)
+	}
+	if block.BaseFee != nil {
+		state.baseFee = block.BaseFee.ToInt()
+		state.metrics[metricBaseFee], _ = new(big.Rat).SetFrac(state.baseFee, gwei).Float64()
+		o.baseFees = pushSample(o.baseFees, sampleValue(state.baseFee, mwei))
+
+		if parentGas != nil {
+			o.corr.addBaseFee(float64(parentGas.Uint64()), state.metrics[metricBaseFee])
+			if o.corr.samples() == 1 {
+				o.dash.reveal("corr")
+			}
+			o.dash.corr.Text = o.corr.text()
+			o.dash.touch(o.dash.corr)
+		}
+		o.sess.addBurn(state.baseFee, uint64(block.GasUsed))
+	}
+	updateTxGasPar(o.dash.txGas, block)
+	if len(o.txs) > 0 {
+		o.dash.txGas.Text += fmt.Sprintf(", %d txs per point", o.txs[len(o.txs)-1])
+	}
+	o.dash.touch(o.dash.txGas)
+	if !o.receipts {
+		return
+	}
+	updateTopTxList(o.dash.topTx, data)
+	o.dash.touch(o.dash.topTx)
+
+	if price, ok := weightedGasPrice(data); ok {
+		o.gasPrice = pushSample(o.gasPrice, sampleValue(price, mwei))
+		o.dash.gasPrice.Lines[0].Data = o.gasPrice
+		o.sess.record("Gas weighted price (mwei)", o.gasPrice)
+		o.dash.gasPrice.Lines[0].Title = formatGwei(price) + " gwei"
+		o.dash.touch(o.dash.gasPrice)
+	}
+	if share, ok := largestTxShare(data); ok {
+		o.txShare = pushSample(o.txShare, int(share))
+		o.dash.txShare.Lines[0].Data = o.txShare
+		o.dash.txShare.Lines[0].Title = formatFloat(share) + "% (gas of largest tx / block gas used)"
+		o.dash.touch(o.dash.txShare)
+	}
+}
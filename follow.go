@@ -0,0 +1,58 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Block tags the dashboard can follow. Safe and finalized blocks lag the
+// latest head, by minutes on proof of stake chains, but don't reorg.
+const (
+	followLatest    = "latest"
+	followSafe      = "safe"
+	followFinalized = "finalized"
+)
+
+var followTags = []string{followLatest, followSafe, followFinalized}
+
+// followed is the index in followTags of the followed tag. It's changed by
+// the follow command while the monitor is running.
+var followed int32
+
+// setFollow changes the followed block tag.
+func setFollow(tag string) error {
+	for i, t := range followTags {
+		if t == tag {
+			atomic.StoreInt32(&followed, int32(i))
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown block tag %q (known: %s)", tag, strings.Join(followTags, ", "))
+}
+
+// following returns the followed block tag.
+func following() string {
+	return followTags[atomic.LoadInt32(&followed)]
+}
+
+// fetchTagged requests the header of the block carrying the tag, e.g. the
+// latest finalized block.
+func fetchTagged(ctx context.Context, client *rpc.Client, tag string) (*types.Header, error) {
+	var header *types.Header
+	if err := client.CallContext(ctx, &header, "eth_getBlockByNumber", tag, false); err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("no %s block", tag)
+	}
+	return header, nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// precision is the number of decimal places used when formatting derived
+// metrics such as averages and rates. It's set by the -precision flag.
+var precision = 2
+
+// formatFloat formats a derived metric using the configured precision.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', precision, 64)
+}
+
+// Block number styles, selected with the -block-format flag.
+const (
+	numberDecimal = "decimal" // 18234567
+	numberGrouped = "grouped" // 18,234,567
+	numberHex     = "hex"     // 0x1163c47
+)
+
+var numberStyles = []string{numberDecimal, numberGrouped, numberHex}
+
+// blockNumbering controls whether block numbers are displayed as absolute
+// chain heights or relative to the first block seen in the session, and in
+// which style. Exports always use the absolute decimal number.
+type blockNumbering struct {
+	mu       sync.Mutex
+	relative bool
+	base     *big.Int
+	style    string // one of numberStyles, decimal if empty
+}
+
+var numbering blockNumbering
+
+// observe records n as the session base if no base has been set yet.
+func (b *blockNumbering) observe(n *big.Int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.base == nil {
+		b.base = new(big.Int).Set(n)
+	}
+}
+
+// toggle switches between absolute and relative numbering and reports
+// whether relative numbering is now active.
+func (b *blockNumbering) toggle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.relative = !b.relative
+	return b.relative
+}
+
+// setStyle selects the style block numbers are displayed in.
+func (b *blockNumbering) setStyle(style string) error {
+	for _, s := range numberStyles {
+		if s == style {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			b.style = style
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown block number format %q (known: %s)", style, strings.Join(numberStyles, ", "))
+}
+
+// cycleStyle switches to the next block number style and returns it.
+func (b *blockNumbering) cycleStyle() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	next := numberStyles[0]
+	for i, s := range numberStyles {
+		if s == b.style {
+			next = numberStyles[(i+1)%len(numberStyles)]
+		}
+	}
+	b.style = next
+	return next
+}
+
+// formatBlockNumber formats a block number for display, labelling block 0 as
+// the genesis block.
+func formatBlockNumber(n *big.Int) string {
+	if n.Sign() == 0 {
+		return "genesis"
+	}
+	numbering.mu.Lock()
+	defer numbering.mu.Unlock()
+
+	if numbering.relative && numbering.base != nil {
+		return "+" + formatNumberStyle(new(big.Int).Sub(n, numbering.base), numbering.style)
+	}
+	return formatNumberStyle(n, numbering.style)
+}
+
+// formatBlockUint formats a block number given as uint64 for display.
+func formatBlockUint(n uint64) string {
+	return formatBlockNumber(new(big.Int).SetUint64(n))
+}
+
+// formatNumberStyle formats n in the given block number style.
+func formatNumberStyle(n *big.Int, style string) string {
+	switch style {
+	case numberHex:
+		return fmt.Sprintf("%#x", n)
+	case numberGrouped:
+		return groupDigits(n.String())
+	}
+	return n.String()
+}
+
+// groupDigits separates the thousands of a decimal number with commas.
+func groupDigits(s string) string {
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b = append(b, ',')
+		}
+		b = append(b, s[i])
+	}
+	return sign + string(b)
+}
+
+// formatHuman formats n with a k/M/G suffix, e.g. 28500000 as "28.5M".
+func formatHuman(n uint64) string {
+	switch {
+	case n >= 1e9:
+		return strconv.FormatFloat(float64(n)/1e9, 'f', 1, 64) + "G"
+	case n >= 1e6:
+		return strconv.FormatFloat(float64(n)/1e6, 'f', 1, 64) + "M"
+	case n >= 1e3:
+		return strconv.FormatFloat(float64(n)/1e3, 'f', 1, 64) + "k"
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// parseHuman parses a number with an optional k/M/G suffix as produced by
+// formatHuman, e.g. "30M" as 30000000.
+func parseHuman(s string) (uint64, error) {
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "G"):
+		mult, s = 1e9, strings.TrimSuffix(s, "G")
+	case strings.HasSuffix(s, "M"):
+		mult, s = 1e6, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1e3, strings.TrimSuffix(s, "k")
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return uint64(f * mult), nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// gasObserver feeds the gas graph and the gas comparison chart. It's only
+// accessed from run, which also owns the lines of the gas graph.
+type gasObserver struct {
+	dash   *dashboard
+	sess   *session
+	scale  string // gas used scaling mode
+	gasMax uint64 // pinned maximum of the gas used graph, 0 if auto
+	trend  *ewma  // long-term average of the gas used percentage
+	sample *sampler
+
+	limit   []int // gas limit in millions of gas
+	used    []int // gas used in units of 100 gas
+	percent []int // gas used percentage
+	avg     []int // long-term average of the gas used percentage
+
+	limitMarks   []int // gas limit points that crossed a notable level
+	builderMarks []int // gas used points holding a tagged builder's block
+	crossed      bool  // whether the current bucket crossed a level
+	tagged       int   // mark of the last tagged block in the current bucket
+}
+
+func newGasObserver(dash *dashboard, sess *session, cfg *config, trend *ewma) *gasObserver {
+	return &gasObserver{
+		dash:   dash,
+		sess:   sess,
+		scale:  cfg.scale,
+		gasMax: cfg.gasMax,
+		trend:  trend,
+		sample: newSampler(cfg.sampleSize, cfg.sampleSpan),
+	}
+}
+
+func (o *gasObserver) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	graph := o.dash.gas
+	if header.GasLimit.Sign() > 0 {
+		o.trend.add(utilisation(header))
+	}
+	graph.BorderLabel = gasLabel(header, graph.ShowAlt.on())
+	o.dash.touch(graph)
+
+	if state.parent != nil {
+		updateGasComparison(o.dash.gasCmp, state.parent.GasUsed, header.GasUsed)
+		o.dash.touch(o.dash.gasCmp)
+	}
+	if state.crossed {
+		o.crossed = true
+	}
+	if m := builderMark(builders, header); m != 0 {
+		o.tagged = m
+	}
+	full := o.sample.add(
+		header.Time.Uint64(),
+		sampleValue(header.GasLimit, big.NewInt(1000000)),
+		sampleValue(header.GasUsed, big.NewInt(gasUnit)),
+		int(utilisation(header)),
+	)
+	if !full {
+		return
+	}
+	p := o.sample.flush()
+
+	o.limit = pushSample(o.limit, p.gasLimit)
+	graph.Lines[0].Data = o.limit
+	mark := 0
+	if o.crossed {
+		mark, o.crossed = 1, false
+	}
+	o.limitMarks = pushSample(o.limitMarks, mark)
+	graph.Lines[0].Marks = o.limitMarks
+	o.sess.record("Gas limit (Mgas)", o.limit)
+
+	o.used = pushSample(o.used, p.gasUsed)
+	o.builderMarks = pushSample(o.builderMarks, o.tagged)
+	o.tagged = 0
+	graph.Lines[1].Marks = o.builderMarks
+	o.sess.record("Gas used (100 gas)", o.used)
+	graph.Lines[1].Data = scaleSeries(o.scale, o.used)
+	switch o.scale {
+	case scaleRollingMax:
+		if max := windowMax(o.used); max > 0 {
+			graph.Lines[1].Title = fmt.Sprintf("Gas used (%d%% of rolling max)", p.gasUsed*100/max)
+		}
+	case scaleAbsolute:
+		graph.Lines[1].Title = "Gas used: " + formatHuman(uint64(p.gasUsed)*gasUnit)
+		if o.gasMax > 0 {
+			graph.Lines[1].Title += " (pinned at " + formatHuman(o.gasMax) + ")"
+		}
+	}
+
+	o.percent = pushSample(o.percent, p.utilisation)
+	o.sess.record("Gas used (%)", o.percent)
+	graph.Alt[0].Data = o.percent
+	o.avg = pushSample(o.avg, int(o.trend.value))
+	o.sess.record("Gas used long-term (%)", o.avg)
+	if o.dash.showPercent.on() != (len(graph.Lines) > 2) {
+		toggleGasPercentLine(graph)
+	}
+	if len(graph.Lines) > 3 {
+		graph.Lines[2].Data = o.percent
+		graph.Lines[3].Data = o.avg
+		graph.Lines[3].Title = utilisationTrendTitle(o.trend.value, o.trend.alpha)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui"
+)
+
+var (
+	gwei  = big.NewInt(1e9)
+	mwei  = big.NewInt(1e6)
+	ether = big.NewInt(1e18)
+)
+
+// effectiveGasPrice returns the price per gas the transaction actually paid.
+// Receipts of post-London nodes report it directly, otherwise it's the gas
+// price of the transaction.
+func effectiveGasPrice(tx *rpcTransaction, receipt *rpcReceipt) *big.Int {
+	if receipt != nil && receipt.EffectiveGasPrice != nil {
+		return receipt.EffectiveGasPrice.ToInt()
+	}
+	if tx.GasPrice != nil {
+		return tx.GasPrice.ToInt()
+	}
+	return new(big.Int)
+}
+
+const (
+	// elasticityMultiplier is the ratio of the gas limit to the gas target
+	// of a London block.
+	elasticityMultiplier = 2
+	// baseFeeChangeDenominator bounds the change of the base fee between two
+	// blocks to 1/8.
+	baseFeeChangeDenominator = 8
+)
+
+// burnedFee returns the wei burned by a block with the given base fee. It's
+// zero for empty blocks.
+func burnedFee(baseFee *big.Int, gasUsed uint64) *big.Int {
+	return new(big.Int).Mul(baseFee, new(big.Int).SetUint64(gasUsed))
+}
+
+// nextBaseFee returns the base fee of the child of a London block as
+// specified by EIP-1559. An empty block lowers it by the full 1/8, a block
+// without gas target keeps it as is.
+func nextBaseFee(baseFee *big.Int, gasUsed, gasLimit uint64) *big.Int {
+	target := gasLimit / elasticityMultiplier
+	if target == 0 || gasUsed == target {
+		return new(big.Int).Set(baseFee)
+	}
+	delta := new(big.Int)
+	if gasUsed > target {
+		delta.SetUint64(gasUsed - target)
+	} else {
+		delta.SetUint64(target - gasUsed)
+	}
+	delta.Mul(delta, baseFee)
+	delta.Div(delta, new(big.Int).SetUint64(target))
+	delta.Div(delta, big.NewInt(baseFeeChangeDenominator))
+
+	if gasUsed > target {
+		if delta.Sign() == 0 {
+			delta.SetInt64(1)
+		}
+		return delta.Add(baseFee, delta)
+	}
+	if next := delta.Sub(baseFee, delta); next.Sign() > 0 {
+		return next
+	}
+	return new(big.Int)
+}
+
+// weightedGasPrice returns the average effective gas price paid per unit of
+// gas in the block, i.e. sum(price_i * gasUsed_i) / sum(gasUsed_i). Since the
+// effective price is base fee plus tip, this equals the gas weighted tip
+// plus the base fee. ok is false for blocks that used no gas.
+func weightedGasPrice(data *blockData) (price *big.Int, ok bool) {
+	if len(data.receipts) != len(data.block.Transactions) {
+		return nil, false
+	}
+	var (
+		paid = new(big.Int)
+		used = new(big.Int)
+	)
+	for i, tx := range data.block.Transactions {
+		gas := new(big.Int).SetUint64(uint64(data.receipts[i].GasUsed))
+		paid.Add(paid, new(big.Int).Mul(effectiveGasPrice(tx, data.receipts[i]), gas))
+		used.Add(used, gas)
+	}
+	if used.Sign() == 0 {
+		return nil, false
+	}
+	return paid.Div(paid, used), true
+}
+
+// formatEther formats a wei amount in ether using the configured precision.
+func formatEther(wei *big.Int) string {
+	f, _ := new(big.Rat).SetFrac(wei, ether).Float64()
+	return formatFloat(f)
+}
+
+// formatGwei formats a wei amount in gwei using the configured precision.
+func formatGwei(wei *big.Int) string {
+	f, _ := new(big.Rat).SetFrac(wei, gwei).Float64()
+	return formatFloat(f)
+}
+
+func newGasPriceGraph() *ui.Sparklines {
+	spark := ui.Sparkline{}
+	spark.Height = 5
+	spark.Title = "enable with -receipts"
+	spark.LineColor = th.gasPrice
+	spark.TitleColor = th.title
+
+	sp := ui.NewSparklines(spark)
+	sp.Height = 8
+	sp.BorderLabel = "Gas weighted price"
+
+	return sp
+}
+
+// feeWindow is the number of recent blocks the gas price percentiles are
+// computed over.
+const feeWindow = 20
+
+// parsePercentiles parses a comma separated list of percentiles, clamping
+// them to 0-100.
+func parsePercentiles(list string) ([]float64, error) {
+	var pcts []float64
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		p, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile %q", s)
+		}
+		pcts = append(pcts, math.Max(0, math.Min(100, p)))
+	}
+	sort.Float64s(pcts)
+	return pcts, nil
+}
+
+// feePercentiles computes percentiles of the effective gas prices paid by
+// the transactions of the last feeWindow fetched blocks, similar to the
+// rewards reported by eth_feeHistory. It's only accessed from run.
+type feePercentiles struct {
+	pcts   []float64
+	blocks [][]*big.Int // effective gas prices per block, oldest first
+}
+
+func newFeePercentiles(pcts []float64) *feePercentiles {
+	return &feePercentiles{pcts: pcts}
+}
+
+// add accounts the gas prices of a fetched block. Receipts are optional.
+func (f *feePercentiles) add(data *blockData) {
+	prices := make([]*big.Int, len(data.block.Transactions))
+	for i, tx := range data.block.Transactions {
+		var receipt *rpcReceipt
+		if len(data.receipts) == len(data.block.Transactions) {
+			receipt = data.receipts[i]
+		}
+		prices[i] = effectiveGasPrice(tx, receipt)
+	}
+	if len(f.blocks) == feeWindow {
+		f.blocks = f.blocks[1:]
+	}
+	f.blocks = append(f.blocks, prices)
+}
+
+// update lists the percentiles of the gas prices within the window using
+// the nearest rank method.
+func (f *feePercentiles) update(list *ui.List) {
+	var prices []*big.Int
+	for _, block := range f.blocks {
+		prices = append(prices, block...)
+	}
+	if len(prices) == 0 {
+		list.Items = []string{"no transactions"}
+		return
+	}
+	sort.Slice(prices, func(a, b int) bool { return prices[a].Cmp(prices[b]) < 0 })
+
+	items := make([]string, len(f.pcts))
+	for i, p := range f.pcts {
+		rank := int(math.Ceil(p/100*float64(len(prices)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		items[i] = fmt.Sprintf("p%-5s %s gwei", strconv.FormatFloat(p, 'f', -1, 64), formatGwei(prices[rank]))
+	}
+	list.Items = items
+	list.BorderLabel = fmt.Sprintf("Gas price percentiles (%d txs, %d blocks)", len(prices), len(f.blocks))
+}
+
+// newFeePercentilesList returns the list of gas price percentiles. Its
+// height is adjusted to the number of percentiles once they're known.
+func newFeePercentilesList() *ui.List {
+	list := ui.NewList()
+	list.Height = 5
+	list.BorderLabel = "Gas price percentiles"
+	list.Items = []string{"enable with -fetch"}
+
+	return list
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestEmptyLondonBlock(t *testing.T) {
+	baseFee := big.NewInt(8000000000) // 8 gwei
+
+	// an empty block lowers the base fee by the full 1/8
+	if got, want := nextBaseFee(baseFee, 0, 30000000), big.NewInt(7000000000); got.Cmp(want) != 0 {
+		t.Errorf("base fee after an empty block %v, want %v", got, want)
+	}
+	// and burns nothing
+	if got := burnedFee(baseFee, 0); got.Sign() != 0 {
+		t.Errorf("empty block burned %v wei, want 0", got)
+	}
+	if baseFee.Cmp(big.NewInt(8000000000)) != 0 {
+		t.Errorf("base fee of the parent modified to %v", baseFee)
+	}
+}
+
+func TestNextBaseFee(t *testing.T) {
+	tests := []struct {
+		name              string
+		baseFee           int64
+		gasUsed, gasLimit uint64
+		want              int64
+	}{
+		{"at target", 1000000000, 15000000, 30000000, 1000000000},
+		{"full block", 1000000000, 30000000, 30000000, 1125000000},
+		{"half above target", 1000000000, 22500000, 30000000, 1062500000},
+		{"empty block", 1000000000, 0, 30000000, 875000000},
+		{"minimal increase", 7, 15000001, 30000000, 8},
+		{"no gas target", 1000000000, 0, 1, 1000000000},
+	}
+	for _, tt := range tests {
+		got := nextBaseFee(big.NewInt(tt.baseFee), tt.gasUsed, tt.gasLimit)
+		if got.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("%s: next base fee %v, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBurnedFee(t *testing.T) {
+	if got, want := burnedFee(big.NewInt(1000000000), 21000), big.NewInt(21000000000000); got.Cmp(want) != 0 {
+		t.Errorf("burned %v wei, want %v", got, want)
+	}
+}
@@ -0,0 +1,417 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	ui "github.com/gizak/termui"
+)
+
+// sparks are the glyphs used to draw a bar of a graph line, in eighths of a
+// cell.
+var sparks = []rune{' ', '▁', '▂', '▃', '▄', '▅', '▆', '▇', '█'}
+
+// Graph styles, selected with the -graph-style flag.
+const (
+	// styleBars fills every point up to its value.
+	styleBars = "bars"
+	// styleLine only draws the top of every point, tracing a line.
+	styleLine = "line"
+)
+
+var graphStyles = []string{styleBars, styleLine}
+
+// graphStyle is the style new graphs are drawn in.
+var graphStyle = styleBars
+
+// minimal drops the borders and border labels of the console and the top
+// graphs, leaving their room to the data. It's set with the -minimal flag.
+var minimal bool
+
+// stripChrome removes the border of the block if the display is minimal.
+// The label is kept: without a border termui draws none, but graphs draw it
+// on their first row as it carries live readouts.
+func stripChrome(b *ui.Block) {
+	if !minimal {
+		return
+	}
+	b.Border = false
+}
+
+// validGraphStyle returns an error if style isn't a known graph style.
+func validGraphStyle(style string) error {
+	for _, s := range graphStyles {
+		if s == style {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown graph style %q (known: %v)", style, graphStyles)
+}
+
+// lineSparks are the scan line glyphs the top of a point is drawn with in
+// the line style, from the bottom of a cell to its top.
+var lineSparks = []rune{'⎽', '⎼', '─', '⎻', '⎺'}
+
+// graphLine is a single line of a graph. It mirrors ui.Sparkline, but can be
+// scaled against a fixed maximum rather than the largest value in the data.
+type graphLine struct {
+	Data       []int
+	Height     int
+	Title      string
+	TitleColor ui.Attribute
+	LineColor  ui.Attribute
+
+	// Max pins the value drawn at full height. Larger values are clamped
+	// and drawn in ClampColor. Zero scales to the largest value.
+	Max        int
+	ClampColor ui.Attribute
+
+	// Marks flags points of Data to be drawn in MarkColor. It's aligned to
+	// Data, non-zero entries mark the point at the same index.
+	Marks     []int
+	MarkColor ui.Attribute
+
+	// MarkColors optionally colours marks by value, mark v is drawn in
+	// MarkColors[v-1] rather than MarkColor.
+	MarkColors []ui.Attribute
+}
+
+// graph is a drop-in replacement of ui.Sparklines drawing graphLines.
+type graph struct {
+	ui.Block
+	Lines []graphLine
+
+	// Overlay draws all lines on top of each other, each normalised to its
+	// own maximum, rather than stacking them. With MinMax, each line spans
+	// the full height between its own minimum and maximum instead, which
+	// makes the shapes of series with small relative changes comparable.
+	Overlay bool
+	MinMax  bool
+
+	// Style is either styleBars or styleLine, overlaid graphs are always
+	// drawn as points.
+	Style string
+
+	// Braille draws the lines with braille dots, two points per cell and
+	// four dots per row, rather than with block glyphs.
+	Braille bool
+
+	// Alt are drawn instead of Lines while ShowAlt is on, e.g. a fixed
+	// scale view of the same data. ShowAlt is flipped from key handlers
+	// while the lines are drawn.
+	Alt     []graphLine
+	ShowAlt toggle
+}
+
+func newGraph(lines ...graphLine) *graph {
+	return &graph{Block: *ui.NewBlock(), Lines: lines, Style: graphStyle}
+}
+
+// toggleStyle switches the graph between the bars and the line style.
+func (g *graph) toggleStyle() {
+	if g.Style == styleLine {
+		g.Style = styleBars
+	} else {
+		g.Style = styleLine
+	}
+}
+
+// Buffer implements ui.Bufferer.
+func (g *graph) Buffer() ui.Buffer {
+	buf := g.Block.Buffer()
+	area := g.InnerBounds()
+	if !g.Border && g.BorderLabel != "" {
+		// the label takes the first row in place of the border
+		for i, r := range []rune(g.BorderLabel) {
+			if area.Min.X+i >= area.Max.X {
+				break
+			}
+			buf.Set(area.Min.X+i, area.Min.Y, ui.Cell{Ch: r, Fg: g.BorderLabelFg, Bg: g.Bg})
+		}
+		area.Min.Y++
+	}
+	if g.Overlay {
+		g.drawOverlay(buf, area)
+		return buf
+	}
+
+	lines := g.Lines
+	if g.ShowAlt.on() && len(g.Alt) > 0 {
+		lines = g.Alt
+	}
+
+	// squeeze the lines if the graph was shrunk below their total height
+	need := 0
+	for _, line := range lines {
+		need += line.Height
+		if line.Title != "" {
+			need++
+		}
+	}
+	avail := area.Dy()
+	top := area.Min.Y
+	for _, line := range lines {
+		if need > avail && need > 0 {
+			line.Height = line.Height * avail / need
+			if line.Height < 1 {
+				line.Height = 1
+			}
+		}
+		height := line.Height
+		if line.Title != "" {
+			height++
+		}
+		if top+height > area.Max.Y {
+			break
+		}
+		if line.Title != "" {
+			for i, r := range []rune(line.Title) {
+				if area.Min.X+i >= area.Max.X {
+					break
+				}
+				buf.Set(area.Min.X+i, top, ui.Cell{Ch: r, Fg: line.TitleColor, Bg: g.Bg})
+			}
+		}
+		if g.Braille {
+			g.drawBraille(buf, line, area.Min.X, area.Dx(), top+height-1)
+		} else {
+			g.drawLine(buf, line, area.Min.X, area.Dx(), top+height-1)
+		}
+		top += height
+	}
+	return buf
+}
+
+// overlayMark is the rune a point of an overlaid line is drawn with.
+const overlayMark = '•'
+
+// drawOverlay draws a legend of the line titles on the first row and all
+// lines as points normalised to their own maximum in the rows below, so
+// that the shapes of series with different units can be compared.
+func (g *graph) drawOverlay(buf ui.Buffer, area image.Rectangle) {
+	x := area.Min.X
+	for _, line := range g.Lines {
+		for _, r := range []rune(string(overlayMark) + " " + line.Title + "  ") {
+			if x >= area.Max.X {
+				break
+			}
+			fg := line.TitleColor
+			if r == overlayMark {
+				fg = line.LineColor
+			}
+			buf.Set(x, area.Min.Y, ui.Cell{Ch: r, Fg: fg, Bg: g.Bg})
+			x++
+		}
+	}
+	height := area.Dy() - 1
+	if height < 1 {
+		return
+	}
+	for _, line := range g.Lines {
+		data := line.Data
+		if len(data) > area.Dx() {
+			data = data[len(data)-area.Dx():]
+		}
+		min, max := 0, windowMax(data)
+		if g.MinMax {
+			min = windowMin(data)
+		}
+		if max <= min {
+			continue
+		}
+		for i, v := range data {
+			if v < min {
+				v = min
+			}
+			y := int(float64(v-min)*float64(height-1)/float64(max-min) + 0.5)
+			buf.Set(area.Min.X+i, area.Max.Y-1-y, ui.Cell{Ch: overlayMark, Fg: line.LineColor, Bg: g.Bg})
+		}
+	}
+}
+
+// drawLine draws the bars of the line with their base at row bottom.
+func (g *graph) drawLine(buf ui.Buffer, line graphLine, left, width, bottom int) {
+	data := line.Data
+	if len(data) > width {
+		data = data[len(data)-width:]
+	}
+	offset := len(line.Data) - len(data)
+	max := line.Max
+	if max == 0 {
+		max = windowMax(data)
+	}
+	if max <= 0 {
+		return
+	}
+	for i, v := range data {
+		color := line.LineColor
+		if j := offset + i; j < len(line.Marks) && line.Marks[j] != 0 {
+			color = line.MarkColor
+			if m := line.Marks[j]; m > 0 && m <= len(line.MarkColors) {
+				color = line.MarkColors[m-1]
+			}
+		}
+		if v > max {
+			v, color = max, line.ClampColor
+		}
+		// height of the bar in eighths of a cell
+		h := 0
+		if v > 0 {
+			h = int(float64(v)*float64(8*line.Height)/float64(max) + 0.5)
+		}
+		if g.Style == styleLine {
+			if h > 0 {
+				r := lineSparks[(h-1)%8*len(lineSparks)/8]
+				buf.Set(left+i, bottom-(h-1)/8, ui.Cell{Ch: r, Fg: color, Bg: g.Bg})
+			}
+			continue
+		}
+		for y := 0; h > 0; y++ {
+			r := sparks[8]
+			if h < 8 {
+				r = sparks[h]
+			}
+			buf.Set(left+i, bottom-y, ui.Cell{Ch: r, Fg: color, Bg: g.Bg})
+			h -= 8
+		}
+	}
+}
+
+// Graph renderers, selected with the -render flag.
+const (
+	renderBlocks  = "blocks"
+	renderBraille = "braille"
+)
+
+// validRenderer returns an error if name isn't a known graph renderer.
+func validRenderer(name string) error {
+	if name != renderBlocks && name != renderBraille {
+		return fmt.Errorf("unknown renderer %q (known: %s, %s)", name, renderBlocks, renderBraille)
+	}
+	return nil
+}
+
+// brailleBlank is the braille glyph without any dots, the dots are or'ed
+// into it.
+const brailleBlank = 0x2800
+
+// brailleDots are the bits of the dots of a braille cell by column and by
+// row from the bottom.
+var brailleDots = [2][4]rune{{0x40, 0x04, 0x02, 0x01}, {0x80, 0x20, 0x10, 0x08}}
+
+// drawBraille draws the line with braille dots with its base at row bottom.
+// Every cell holds two points, each resolved to a quarter of a row. In the
+// line style, consecutive points are connected vertically.
+func (g *graph) drawBraille(buf ui.Buffer, line graphLine, left, width, bottom int) {
+	data := line.Data
+	if len(data) > 2*width {
+		data = data[len(data)-2*width:]
+	}
+	offset := len(line.Data) - len(data)
+	max := line.Max
+	if max == 0 {
+		max = windowMax(data)
+	}
+	if max <= 0 {
+		return
+	}
+	var (
+		rows   = 4 * line.Height
+		dots   = make(map[image.Point]rune)
+		colors = make(map[image.Point]ui.Attribute)
+		prev   = -1
+	)
+	for i, v := range data {
+		color := line.LineColor
+		if j := offset + i; j < len(line.Marks) && line.Marks[j] != 0 {
+			color = line.MarkColor
+			if m := line.Marks[j]; m > 0 && m <= len(line.MarkColors) {
+				color = line.MarkColors[m-1]
+			}
+		}
+		if v > max {
+			v, color = max, line.ClampColor
+		}
+		if v < 0 {
+			v = 0
+		}
+		level := int(float64(v)*float64(rows-1)/float64(max) + 0.5)
+
+		lo, hi := 0, level
+		switch {
+		case g.Style == styleLine && prev >= 0 && prev < level:
+			lo = prev + 1
+		case g.Style == styleLine && prev > level:
+			lo, hi = level, prev-1
+		case g.Style == styleLine:
+			lo = level
+		case v == 0:
+			lo = 1 // empty bar
+		}
+		for y := lo; y <= hi; y++ {
+			p := image.Pt(left+i/2, bottom-y/4)
+			dots[p] |= brailleDots[i%2][y%4]
+			if _, ok := colors[p]; !ok || color != line.LineColor {
+				colors[p] = color
+			}
+		}
+		prev = level
+	}
+	for p, bits := range dots {
+		buf.Set(p.X, p.Y, ui.Cell{Ch: brailleBlank | bits, Fg: colors[p], Bg: g.Bg})
+	}
+}
+
+// overlayColors are the colours assigned to the overlaid lines in order.
+func overlayColors() []ui.Attribute {
+	return []ui.Attribute{th.gasUsed, th.gasPrice, th.blockTime, th.gasLimit, th.accentColor}
+}
+
+// overlayMetrics are the series that can be overlaid with -overlay.
+var overlayMetrics = []string{"gasused", "utilisation", "blocktime", "basefee", "gasprice"}
+
+// parseOverlay parses the comma separated list of overlaid series.
+func parseOverlay(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		known := false
+		for _, m := range overlayMetrics {
+			known = known || m == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown overlay series %q (known: %s)", name, strings.Join(overlayMetrics, ","))
+		}
+		names = append(names, name)
+	}
+	if len(names) == 1 || len(names) > len(overlayColors()) {
+		return nil, fmt.Errorf("overlay needs 2 to %d series", len(overlayColors()))
+	}
+	return names, nil
+}
+
+// newOverlayGraph returns a graph overlaying the named series. With minMax
+// every series is scaled between its own minimum and maximum.
+func newOverlayGraph(names []string, minMax bool) *graph {
+	colors := overlayColors()
+	lines := make([]graphLine, len(names))
+	for i, name := range names {
+		lines[i] = graphLine{Title: name, LineColor: colors[i], TitleColor: th.title}
+	}
+	g := newGraph(lines...)
+	g.Overlay, g.MinMax = true, minMax
+	g.Height = 10
+	g.BorderLabel = "Overlay (normalised to the window maximum)"
+	if minMax {
+		g.BorderLabel = "Overlay (independent min/max scales)"
+	}
+
+	return g
+}
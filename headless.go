@@ -0,0 +1,82 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// jsonLines streams the block events as JSON lines in headless mode, e.g.
+// to stdout for piping into other tools.
+type jsonLines struct {
+	mu  sync.Mutex
+	enc *json.Encoder // nil once writing failed
+}
+
+func newJSONLines(w io.Writer) *jsonLines {
+	return &jsonLines{enc: json.NewEncoder(w)}
+}
+
+// jsonLine is a line of the JSON lines output, the block event along with
+// what the monitor measured up to the block.
+type jsonLine struct {
+	*blockEvent
+	BlockTime        *float64 `json:"blockTime,omitempty"`    // seconds since the parent block
+	AvgBlockTime     *float64 `json:"avgBlockTime,omitempty"` // seconds, over the graph window
+	UtilisationTrend float64  `json:"utilisationTrend"`       // long-term average of the utilisation
+	Peers            *int     `json:"peers,omitempty"`        // once the peer count was polled
+}
+
+// write appends the line. It's nil safe so that run can write
+// unconditionally, and stops at the first error, e.g. a closed pipe.
+func (l *jsonLines) write(line *jsonLine) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.enc == nil {
+		return nil
+	}
+	if err := l.enc.Encode(line); err != nil {
+		l.enc = nil
+		return err
+	}
+	return nil
+}
+
+// writeError appends a line describing why the monitor stopped, e.g.
+//
+//	{"error": "no connection to ws://localhost:8546 within 1m0s"}
+func (l *jsonLines) writeError(err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.enc != nil {
+		l.enc.Encode(map[string]string{"error": err.Error()})
+	}
+}
+
+// waitHeadless blocks until run returned or the process is told to stop,
+// e.g. by systemd. It takes the place of the UI loop in headless mode.
+func waitHeadless(done <-chan struct{}) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	select {
+	case <-done:
+	case <-sigs:
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// healthHandler serves the liveness and readiness checks of the monitor for
+// orchestrators and load balancers:
+//
+//	/healthz is 200 while advancing heads keep arriving and 503 once they
+//	         stalled or the node disconnected
+//	/readyz  is 200 once the first block has been processed
+type healthHandler struct {
+	sess *session
+}
+
+func (h *healthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/healthz":
+		if down := h.sess.connection(); !down.IsZero() {
+			http.Error(w, fmt.Sprintf("disconnected for %v", time.Since(down).Round(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+		last, avg := h.sess.arrivals()
+		if last.IsZero() {
+			http.Error(w, "no heads received", http.StatusServiceUnavailable)
+			return
+		}
+		since := time.Since(last)
+		if healthLevel(since, avg) == levelBad {
+			http.Error(w, fmt.Sprintf("stalled: last head %v ago", since.Round(time.Second)), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "ok: last head %v ago\n", since.Round(time.Second))
+	case "/readyz":
+		if h.sess.head() == nil {
+			http.Error(w, "no block processed", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveHealth serves the health checks on the listener until it's closed.
+func serveHealth(l net.Listener, sess *session, console *console) {
+	if err := http.Serve(l, &healthHandler{sess: sess}); err != nil {
+		console.writeln("Health endpoint stopped: ", err)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(sess *session)
+		want  int
+	}{
+		{"no heads", func(sess *session) {}, http.StatusServiceUnavailable},
+		{"fresh head", func(sess *session) {
+			sess.arrived(time.Now())
+		}, http.StatusOK},
+		{"disconnected", func(sess *session) {
+			sess.arrived(time.Now())
+			sess.disconnected(time.Now())
+		}, http.StatusServiceUnavailable},
+		{"reconnected", func(sess *session) {
+			sess.disconnected(time.Now())
+			sess.reconnected()
+			sess.arrived(time.Now())
+		}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		sess := newSession()
+		tt.setup(sess)
+
+		rec := httptest.NewRecorder()
+		(&healthHandler{sess: sess}).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+		if rec.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, rec.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// history is the number of blocks the caches of the monitor keep: the
+// recent headers of the session and the per block withdrawals and token
+// transfers. Older entries are evicted as new blocks arrive. It's set with
+// the -history flag.
+var history int32 = maxSamples
+
+// historyLimit returns the number of blocks kept by the caches.
+func historyLimit() int {
+	return int(atomic.LoadInt32(&history))
+}
+
+// setHistoryLimit changes the number of blocks kept by the caches.
+func setHistoryLimit(n int) {
+	atomic.StoreInt32(&history, int32(n))
+}
+
+// evictions returns the number of the oldest entries to drop from a cache
+// of n entries to make room for a new one.
+func evictions(n int) int {
+	if drop := n - historyLimit() + 1; drop > 0 {
+		return drop
+	}
+	return 0
+}
+
+// memoryFootprint returns the bytes currently allocated on the heap.
+func memoryFootprint() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
@@ -0,0 +1,212 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// defaultHeadBuffer is the default number of headers queued between the
+	// subscription and the monitor loop. A larger buffer, set with
+	// -head-buffer, absorbs longer bursts and processing stalls before heads
+	// are dropped, at the cost of memory and of showing stale heads longer.
+	defaultHeadBuffer = 16
+	// pressureStreak is the number of consecutive heads that must find the
+	// head buffer at least three quarters full before a warning is logged.
+	pressureStreak = 10
+	// pressureWarnInterval rate limits the buffer pressure warnings.
+	pressureWarnInterval = time.Minute
+)
+
+// pressureMonitor watches the fill level of the head buffer and reports
+// when it is consistently near full, i.e. the UI lags behind the node.
+type pressureMonitor struct {
+	streak   int
+	lastWarn time.Time
+}
+
+// observe records the buffer level seen when a head was taken off the
+// buffer and reports whether a warning should be logged.
+func (p *pressureMonitor) observe(queued, capacity int) bool {
+	if capacity == 0 || queued*4 < capacity*3 {
+		p.streak = 0
+		return false
+	}
+	p.streak++
+	if p.streak < pressureStreak || time.Since(p.lastWarn) < pressureWarnInterval {
+		return false
+	}
+	p.lastWarn = time.Now()
+	return true
+}
+
+// forwardHeads relays headers from src to dst without ever blocking the
+// subscription. If dst is full because the monitor loop can't keep up, the
+// oldest queued header is discarded in favour of the new one and the drop is
+// accounted in the session. If non-nil, received is called for every header
+// taken from src.
+func forwardHeads(ctx context.Context, src <-chan *types.Header, dst chan *types.Header, sess *session, received func()) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case header := <-src:
+			if received != nil {
+				received()
+			}
+			sess.observeTip(header.Number.Uint64())
+			select {
+			case dst <- header:
+				continue
+			default:
+			}
+			// queue is full, coalesce by evicting the oldest header
+			select {
+			case <-dst:
+				sess.dropHead()
+			default:
+			}
+			select {
+			case dst <- header:
+			default:
+				sess.dropHead()
+			}
+		}
+	}
+}
+
+const (
+	// maxGapFill is the maximum number of missed blocks fetched after a
+	// resubscription.
+	maxGapFill = 128
+)
+
+// dial connects to the node until it succeeds or ctx is cancelled, waiting
+// out the backoff between attempts. Invalid endpoints fail right away. With
+// giveUp set, e.g. from -idle-exit, an unreachable node is given up on after
+// that long.
+func dial(ctx context.Context, endpoint string, retry *backoff, giveUp time.Duration, sess *session, console *console) (*rpc.Client, error) {
+	if _, err := endpointTransport(endpoint); err != nil {
+		return nil, err
+	}
+	dialCtx := ctx
+	if giveUp > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, giveUp)
+		defer cancel()
+	}
+	for failed := false; ; failed = true {
+		client, err := dialEndpoint(dialCtx, endpoint)
+		if err == nil {
+			retry.reset()
+			if failed {
+				sess.reconnected()
+			}
+			return client, nil
+		}
+		if !failed {
+			sess.disconnected(time.Now())
+		}
+		console.alert(levelBad, fmt.Sprintf("connecting to %s failed, retrying with backoff: %s", redactEndpoint(endpoint), redactError(err, endpoint)))
+
+		if err := retry.wait(dialCtx); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, fmt.Errorf("no connection to %s within %v", redactEndpoint(endpoint), giveUp)
+		}
+	}
+}
+
+// resubscribe subscribes to new heads until it succeeds or ctx is cancelled,
+// waiting out the backoff between attempts. The backoff is only reset by the
+// caller once heads arrive again, so that a subscription dropping right
+// after it was set up keeps backing off.
+func resubscribe(ctx context.Context, client *ethclient.Client, ch chan<- *types.Header, retry *backoff, console *console) (ethereum.Subscription, error) {
+	for {
+		sub, err := client.SubscribeNewHead(ctx, ch)
+		if err == nil {
+			return sub, nil
+		}
+		console.alert(levelBad, "resubscribe failed: "+err.Error())
+
+		if err := retry.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// backfillBlocks is the number of recent blocks fetched on startup to detect
+// the block interval of the chain.
+const backfillBlocks = 32
+
+// backfill fetches the latest header and up to backfillBlocks headers before
+// it, oldest first. Blocks the node doesn't have are skipped and counted in
+// missing. On error, the headers fetched so far are returned.
+func backfill(ctx context.Context, client *ethclient.Client) (headers []*types.Header, missing int, err error) {
+	latest, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	from := new(big.Int).Sub(latest.Number, big.NewInt(backfillBlocks+1))
+	if from.Sign() < 0 {
+		from.SetInt64(-1)
+	}
+	headers, _, missing, err = fillGap(ctx, client, from, latest.Number)
+	return append(headers, latest), missing, err
+}
+
+// pruneBoundary is the number of consecutive missing blocks after which the
+// node is assumed to have pruned all older blocks.
+const pruneBoundary = 3
+
+// fillGap fetches the headers strictly between from and to, oldest first. At
+// most maxGapFill of the most recent headers are fetched, truncated reports
+// whether older ones were skipped. Headers are fetched newest first so that
+// a pruned node yields the recent blocks it still has: blocks it doesn't
+// have are skipped and counted in missing, and once pruneBoundary blocks in
+// a row are missing, all older ones are counted as missing too. On error,
+// the headers fetched so far are returned.
+func fillGap(ctx context.Context, client *ethclient.Client, from, to *big.Int) (headers []*types.Header, truncated bool, missing int, err error) {
+	first := new(big.Int).Add(from, big.NewInt(1))
+	if gap := new(big.Int).Sub(to, first); gap.Cmp(big.NewInt(maxGapFill)) > 0 {
+		first.Sub(to, big.NewInt(maxGapFill))
+		truncated = true
+	}
+	var reversed []*types.Header
+	defer func() {
+		for i := len(reversed) - 1; i >= 0; i-- {
+			headers = append(headers, reversed[i])
+		}
+	}()
+
+	consecutive := 0
+	for n := new(big.Int).Sub(to, big.NewInt(1)); n.Cmp(first) >= 0; n = new(big.Int).Sub(n, big.NewInt(1)) {
+		header, err := client.HeaderByNumber(ctx, n)
+		if err == ethereum.NotFound || (err == nil && header == nil) {
+			missing++
+			if consecutive++; consecutive == pruneBoundary {
+				missing += int(new(big.Int).Sub(n, first).Int64())
+				return nil, truncated, missing, nil
+			}
+			continue
+		}
+		if err != nil {
+			return nil, truncated, missing, err
+		}
+		consecutive = 0
+		reversed = append(reversed, header)
+	}
+	return nil, truncated, missing, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	ui "github.com/gizak/termui"
+)
+
+// l1Watcher follows the batch or state root postings of a rollup to its L1
+// contract and correlates them with the L2 block feed shown by the
+// dashboard. It's written by watch and read by the UI goroutine.
+type l1Watcher struct {
+	endpoint string
+	contract common.Address
+	topic    *common.Hash // optional event signature the logs are filtered on
+
+	mu          sync.Mutex
+	postings    int
+	lastPosting time.Time     // local time of the last posting
+	lastL1Block uint64        // L1 block of the last posting
+	lastTx      common.Hash   // L1 transaction of the last posting
+	avgInterval time.Duration // moving average of the posting cadence
+	l2AtPosting uint64        // L2 head at the time of the last posting
+}
+
+func newL1Watcher(endpoint string, contract common.Address, topic *common.Hash) *l1Watcher {
+	return &l1Watcher{endpoint: endpoint, contract: contract, topic: topic}
+}
+
+// watch subscribes to the logs of the L1 contract until ctx is cancelled.
+func (w *l1Watcher) watch(ctx context.Context, sess *session, console *console) {
+	rpcClient, err := dialEndpoint(ctx, w.endpoint)
+	if err != nil {
+		console.alert(levelWarn, fmt.Sprint("L1: failed to attach: ", err))
+		return
+	}
+	client := ethclient.NewClient(rpcClient)
+	query := ethereum.FilterQuery{Addresses: []common.Address{w.contract}}
+	if w.topic != nil {
+		query.Topics = [][]common.Hash{{*w.topic}}
+	}
+	logs := make(chan types.Log)
+	sub, err := client.SubscribeFilterLogs(ctx, query, logs)
+	if err != nil {
+		console.alert(levelWarn, fmt.Sprint("L1: failed to subscribe to logs: ", err))
+		return
+	}
+	defer sub.Unsubscribe()
+	console.writef("OK: Watching L1 contract %s", w.contract.Hex())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-sub.Err():
+			console.alert(levelWarn, fmt.Sprint("L1: log subscription dropped: ", err))
+			return
+		case log := <-logs:
+			if log.Removed {
+				continue
+			}
+			var l2 uint64
+			if head := sess.head(); head != nil {
+				l2 = head.Number.Uint64()
+			}
+			w.posted(log, l2, time.Now())
+			console.writef("L1: posting in block %s (tx %s) at L2 head %s", formatBlockUint(log.BlockNumber), shortHex(log.TxHash.Hex()), formatBlockUint(l2))
+		}
+	}
+}
+
+// posted records a posting seen at local time t while the L2 head was l2.
+func (w *l1Watcher) posted(log types.Log, l2 uint64, t time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.lastPosting.IsZero() {
+		interval := t.Sub(w.lastPosting)
+		if w.avgInterval == 0 {
+			w.avgInterval = interval
+		} else {
+			w.avgInterval = (4*w.avgInterval + interval) / 5
+		}
+	}
+	w.postings++
+	w.lastPosting = t
+	w.lastL1Block = log.BlockNumber
+	w.lastTx = log.TxHash
+	w.l2AtPosting = l2
+}
+
+// summary renders the posting cadence and the lag of L1 behind the L2 head.
+func (w *l1Watcher) summary(l2Head uint64) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.postings == 0 {
+		return "waiting for the first posting..."
+	}
+	var pending uint64
+	if l2Head > w.l2AtPosting {
+		pending = l2Head - w.l2AtPosting
+	}
+	return fmt.Sprintf("last posting L1 #%d, %v ago | avg cadence %v | %d postings\n%d L2 blocks since last posting",
+		w.lastL1Block, time.Since(w.lastPosting).Round(time.Second), w.avgInterval.Round(time.Second), w.postings, pending)
+}
+
+func newL1Par() *ui.Par {
+	par := ui.NewPar("enable with -l1 and -l1-contract")
+	par.Height = 4
+	par.BorderLabel = "L1 postings"
+
+	return par
+}
@@ -6,186 +6,1644 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"math/big"
+	"net"
 	"os"
-	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	ui "github.com/gizak/termui"
 )
 
-// console embeds a ui.Par which is used to write out
-// log messages. It keeps track of the messages in a
-// buffer such that old messages can be evicted if the
-// buffer is too full.
-type console struct {
-	*ui.Par
+const (
+	// defaultBlockTime is the expected block interval assumed until the
+	// interval of the chain is known.
+	defaultBlockTime = 13 * time.Second
+	// rateWindow is the number of trailing blocks the block rate is
+	// computed over.
+	rateWindow = 10
+	// maxSamples is the number of points kept for each graph.
+	maxSamples = 100
+	// shutdownTimeout is how long main waits for run to return on quit.
+	shutdownTimeout = 2 * time.Second
+)
+
+// blockRate returns the number of blocks per minute given the timestamps
+// of consecutive blocks. It returns 0 if the rate can't be determined.
+func blockRate(times []uint64) float64 {
+	if len(times) < 2 {
+		return 0
+	}
+	span := times[len(times)-1] - times[0]
+	if span == 0 {
+		return 0
+	}
+	return float64(len(times)-1) * 60 / float64(span)
+}
 
-	msgs []string
+// rateLevel returns the level of the block rate relative to the expected
+// rate.
+func rateLevel(rate float64) level {
+	expected := float64(time.Minute) / float64(expectedBlockTime())
+	switch {
+	case rate >= expected*0.9:
+		return levelGood
+	case rate >= expected*0.5:
+		return levelWarn
+	default:
+		return levelBad
+	}
 }
 
-// newConsole returns a new console
-func newConsole(height int) *console {
-	par := ui.NewPar("")
-	par.Height = height
-	par.BorderLabel = "Console"
+// utilisation returns the gas used by the block as a percentage of its gas
+// limit. The header isn't modified.
+func utilisation(header *types.Header) float64 {
+	if header.GasLimit.Sign() == 0 {
+		return 0
+	}
+	util, _ := new(big.Rat).SetFrac(header.GasUsed, header.GasLimit).Float64()
+	return util * 100
+}
 
-	return &console{Par: par}
+// gasReadout formats the block's gas used both in absolute terms and as a
+// percentage of the gas limit, e.g. "18.4M gas (61% of 30.0M)".
+func gasReadout(header *types.Header) string {
+	return fmt.Sprintf("%s gas (%.0f%% of %s)",
+		formatHuman(header.GasUsed.Uint64()), utilisation(header), formatHuman(header.GasLimit.Uint64()))
 }
 
-func (c *console) writeln(msg ...interface{}) {
-	if len(c.msgs) > c.Par.Height-3 {
-		c.msgs = c.msgs[1:]
+// gasLabel returns the border label of the gas graph, naming the view
+// toggled with v.
+func gasLabel(header *types.Header, percent bool) string {
+	if percent {
+		return "Gas used % (v for raw): " + gasReadout(header)
 	}
-	c.msgs = append(c.msgs, fmt.Sprint(msg...))
-	c.Par.Text = strings.Join(c.msgs, "\n")
+	return "Gas statistics (v for %): " + gasReadout(header)
 }
 
-func (c *console) writef(format string, a ...interface{}) {
-	if len(c.msgs) > c.Par.Height-3 {
-		c.msgs = c.msgs[1:]
+// chainID requests the EIP-155 chain ID of the node, which unlike the
+// network ID of net_version identifies the chain transactions are signed for.
+func chainID(ctx context.Context, client *rpc.Client) (*big.Int, error) {
+	var id hexutil.Big
+	if err := client.CallContext(ctx, &id, "eth_chainId"); err != nil {
+		return nil, err
 	}
-	c.msgs = append(c.msgs, fmt.Sprintf(format, a...))
-	c.Par.Text = strings.Join(c.msgs, "\n")
+	return id.ToInt(), nil
 }
 
-func run(path string, console *console, gasGraph, blockTimeGraph *ui.Sparklines) error {
-	client, err := ethclient.Dial(path)
+// identifyEndpoint records the chain ID and the endpointID of the node in
+// the session and reports the stats of earlier sessions against it from the
+// state file, if any.
+func identifyEndpoint(ctx context.Context, client *rpc.Client, cfg *config, sess *session, console *console) {
+	chain, err := chainID(ctx, client)
 	if err != nil {
-		panic(err)
+		console.alert(levelWarn, fmt.Sprint("failed to identify the endpoint: ", err))
+		return
 	}
-	console.writeln("OK: Attached to client")
+	id := endpointID(chain, cfg.path)
+	sess.setEndpoint(chain, id)
+	if cfg.statePath == "" {
+		return
+	}
+
+	state, err := loadState(cfg.statePath)
+	if err != nil {
+		console.alert(levelWarn, fmt.Sprint("failed to load the state file: ", err))
+		return
+	}
+	if stats := state[id]; stats != nil {
+		console.writeln("Endpoint seen before: ", describeEndpoint(stats))
+	} else {
+		console.writeln("Endpoint not seen before, chain ", chain)
+	}
+}
+
+// isEarlyBlock reports whether the header is the genesis block or carries a
+// zero timestamp, as is common for dev chains. Such headers must not be used
+// as the base of a block time measurement.
+func isEarlyBlock(header *types.Header) bool {
+	return header.Number.Sign() == 0 || header.Time.Sign() == 0
+}
+
+// errIdle is returned by run if no head arrived within -idle-exit.
+var errIdle = errors.New("idle timeout")
 
+// exitIdle is the exit code after an idle timeout.
+const exitIdle = 3
+
+func run(ctx context.Context, cfg *config, dash *dashboard, sess *session, exp *exporter, events *eventSocket, metrics *chainMetrics, lines *jsonLines) error {
+	rpcClient, err := dial(ctx, cfg.path, newBackoff(cfg.backoffInitial, cfg.backoffMax), cfg.idleExit, sess, dash.console)
+	if err != nil {
+		return err
+	}
+	client := ethclient.NewClient(rpcClient)
 	var (
-		ctx     = context.Background()
-		million = big.NewInt(1000000)
+		console        = dash.console
+		anomalies      = dash.anomalies
+		gasGraph       = dash.gas
+		blockTimeGraph = dash.blockTime
+	)
+	console.writeln("OK: Attached to client")
+
+	identifyEndpoint(ctx, rpcClient, cfg, sess, console)
 
-		gasLimit  []int
-		gasUsed   []int
-		blockTime []int
+	// blocks of tagged builders are marked in the gas used line
+	gasGraph.Lines[1].MarkColors = builderMarkColors(builders)
+
+	// pin the graph maxima; gas used is plotted in units of 100 gas and a
+	// pin makes no sense for the relative rolling max scale
+	switch {
+	case cfg.gasMax > 0 && cfg.scale == scaleRaw:
+		gasGraph.Lines[1].Max = int(cfg.gasMax / gasUnit)
+		gasGraph.Lines[1].Title = fmt.Sprintf("Gas used (pinned at %s)", formatHuman(cfg.gasMax))
+	case cfg.gasMax > 0 && cfg.scale == scaleAbsolute:
+		gasGraph.Lines[1].Max = int(cfg.gasMax)
+	}
+	if cfg.blockTimeMax > 0 {
+		blockTimeGraph.Lines[0].Max = cfg.blockTimeMax
+	}
+
+	caps := probeCapabilities(ctx, rpcClient, cfg, console)
+	updateCapabilitiesList(dash.caps, caps)
+	dash.touch(dash.caps)
+
+	// the long-term average of the gas used percentage is seeded from the
+	// backfilled blocks, if any
+	trend := &ewma{alpha: cfg.utilisationDecay}
+	if cfg.blockTime > 0 {
+		setExpectedBlockTime(cfg.blockTime)
+	} else {
+		headers, missing, err := backfill(ctx, client)
+		for _, h := range headers {
+			if h.GasLimit.Sign() > 0 {
+				trend.add(utilisation(h))
+			}
+		}
+		if err != nil {
+			console.writeln("Backfill stopped early: ", err)
+		}
+		if missing > 0 {
+			console.writef("Backfill: fetched %d blocks, %d unavailable on this node", len(headers), missing)
+		}
+		if d, ok := medianBlockTime(headers); ok && d > 0 {
+			setExpectedBlockTime(d)
+			console.writef("OK: Detected a block time of %v over %d blocks", d, len(headers))
+		} else {
+			console.writef("Too few blocks to detect the block time, assuming %v", defaultBlockTime)
+		}
+	}
+
+	var (
+		procTime []int // local processing time per block in ms
 
 		lastHeader *types.Header
+		loops      = newLoopDetector()
+
+		subCh = make(chan *types.Header)
+		ch    = make(chan *types.Header, cfg.headBuffer)
+
+		pressure pressureMonitor
+	)
+	// some providers accept the subscription but never deliver heads, in
+	// which case the node is polled until the subscription comes alive
+	var subFlowing toggle
+	go forwardHeads(ctx, subCh, ch, sess, func() { subFlowing.set(true) })
+
+	noHeads := time.NewTimer(cfg.headTimeout)
+	defer noHeads.Stop()
 
-		ch = make(chan *types.Header)
+	// nodes that can't push heads, e.g. over HTTP, are polled right away;
+	// subErr and noHeadsC stay nil then and never fire
+	var (
+		subErr   <-chan error
+		noHeadsC <-chan time.Time
 	)
-	sub, err := client.SubscribeNewHead(ctx, ch)
+	sub, err := client.SubscribeNewHead(ctx, subCh)
+	if err != nil {
+		console.writef("No head subscription (%v), polling every %v", err, pollInterval)
+		pollCh := make(chan *types.Header)
+		go forwardHeads(ctx, pollCh, ch, sess, nil)
+		go pollHeads(ctx, client, pollCh, func() bool { return false }, newBackoff(cfg.backoffInitial, cfg.backoffMax), console)
+	} else {
+		defer func() { sub.Unsubscribe() }()
+		subErr, noHeadsC = sub.Err(), noHeads.C
+	}
+
+	go trackTip(ctx, client, sess)
+	if caps[capSyncing] {
+		go trackSync(ctx, client, sess)
+	}
+
+	drift := newDriftDetector(cfg.driftMax)
+	resubscribes := newBackoff(cfg.backoffInitial, cfg.backoffMax)
+
+	// the fee history is refreshed every block time, if the node has it
+	var feeTick <-chan time.Time
+	if cfg.feeHistory > 0 {
+		if caps[capFeeHistory] {
+			ticker := time.NewTicker(expectedBlockTime())
+			defer ticker.Stop()
+			feeTick = ticker.C
+		} else {
+			console.writeln("Fee history disabled: the node doesn't support eth_feeHistory")
+		}
+	}
+	feeHistSeen := false
+
+	// the peer count is also polled for the metrics and the JSON lines,
+	// without the panels
+	var peerTick <-chan time.Time
+	peers := newPeerMonitor(rpcClient)
+	peerCount := -1 // until polled
+	if cfg.peers || metrics != nil || lines != nil {
+		ticker := time.NewTicker(peerInterval)
+		defer ticker.Stop()
+		peerTick = ticker.C
+	}
+
+	// without -idle-exit the idle channel stays nil and never fires
+	var idle <-chan time.Time
+	idleTimer := time.NewTimer(cfg.idleExit)
+	defer idleTimer.Stop()
+	if cfg.idleExit > 0 {
+		idle = idleTimer.C
+	}
+
+	// observers handle the features fed with every processed head, in the
+	// order they're registered
+	var observers pipeline
+
+	// the built-in observers come first, they fill in the block state for
+	// the features registered after them
+	corr := newCorrelations()
+	gas := newGasObserver(dash, sess, cfg, trend)
+	blockTimes := newBlockTimeObserver(dash, sess, cfg, corr)
+	fetched := newFetchObserver(dash, sess, rpcClient, cfg, corr)
+	observers.register(newGasLimitObserver(cfg.gasLevels, londonBlock(sess.chain()), console))
+	observers.register(blockTimes)
+	if cfg.fetch {
+		observers.register(fetched)
+	}
+	observers.register(gas)
+
+	observers.register(newStateRootObserver(dash))
+	observers.register(observerFunc(func(ctx context.Context, header *types.Header, state *blockState) {
+		sess.observeExtremes(header, state.metrics)
+	}))
+	if len(cfg.rules) > 0 {
+		observers.register(newRuleObserver(cfg.rules, cfg.ruleWebhook, anomalies, console))
+	}
+	if cfg.spikePct > 0 {
+		var prices *ethclient.Client
+		if cfg.spikePrice {
+			prices = client
+		}
+		observers.register(newSpikeObserver(newSpikeDetector(cfg.spikePct, cfg.spikeBlocks), prices, cfg.spikeLog, anomalies, console))
+	}
+	if len(cfg.overlay) > 0 {
+		observers.register(observerFunc(func(ctx context.Context, header *types.Header, state *blockState) {
+			series := map[string][]int{
+				"gasused":     gas.used,
+				"utilisation": gas.percent,
+				"blocktime":   blockTimes.series,
+				"basefee":     fetched.baseFees,
+				"gasprice":    fetched.gasPrice,
+			}
+			for i, name := range cfg.overlay {
+				dash.overlay.Lines[i].Data = series[name]
+			}
+			dash.touch(dash.overlay)
+		}))
+	}
+	if metrics != nil {
+		observers.register(metrics)
+	}
+	// the block is published and logged last, once all features saw it
+	observers.register(observerFunc(func(ctx context.Context, header *types.Header, state *blockState) {
+		event := newBlockEvent(header, state.block)
+		sess.addEvent(event)
+		events.publish(event)
+		line := &jsonLine{blockEvent: event, UtilisationTrend: trend.value}
+		if t, ok := state.metrics[metricBlockTime]; ok {
+			line.BlockTime = &t
+		}
+		if len(blockTimes.series) > 0 {
+			avg := mean(blockTimes.series) / float64(blockTimeScales[blockTimeUnit])
+			line.AvgBlockTime = &avg
+		}
+		if peerCount >= 0 {
+			count := peerCount
+			line.Peers = &count
+		}
+		if err := lines.write(line); err != nil {
+			console.alert(levelWarn, fmt.Sprint("failed to write JSON line, stopped streaming: ", err))
+		}
+
+		if err := exp.writeHeader(header); err != nil {
+			console.alert(levelWarn, fmt.Sprint("failed to export block: ", err))
+		}
+
+		hash := header.Hash()
+		if i := matchBuilder(builders, header); i >= 0 {
+			console.logf(msgBlock, "Added block: %s %x %s", formatBlockNumber(header.Number), hash[:4], builderMarkup(builders[i]))
+		} else {
+			console.logf(msgBlock, "Added block: %s %x", formatBlockNumber(header.Number), hash[:4])
+		}
+	}))
+
+	// process passes a newly received header through the observers
+	process := func(header *types.Header) {
+		start := time.Now()
+		defer func() {
+			elapsed := time.Since(start)
+			sess.processed(elapsed)
+
+			procTime = pushSample(procTime, int(elapsed/time.Millisecond))
+			dash.proc.Lines[0].Data = procTime
+			sess.record("Processing time (ms)", procTime)
+			dash.proc.Lines[0].Title = "last " + elapsed.Round(time.Millisecond).String()
+			dash.touch(dash.proc)
+		}()
+		sess.addHeader(header)
+		numbering.observe(header.Number)
+
+		observers.onHeader(ctx, header, &blockState{
+			parent:  lastHeader,
+			arrival: start,
+			metrics: map[string]float64{
+				metricUtilisation: utilisation(header),
+				metricGasUsed:     float64(header.GasUsed.Uint64()),
+				metricGasLimit:    float64(header.GasLimit.Uint64()),
+			},
+		})
+		lastHeader = header
+	}
+
+	// the followed block tag is polled unless it's the latest head
+	tag := followLatest
+	followTick := time.NewTicker(pollInterval)
+	defer followTick.Stop()
+
+	// gapFill is set after a resubscription so that the blocks missed
+	// during the outage are fetched before resuming the live stream.
+	gapFill := false
 	for {
 		select {
+		case <-ctx.Done():
+			return ctx.Err()
 		case header := <-ch:
-			if len(gasLimit) == 100 {
-				gasLimit = gasLimit[1:]
+			if !isEarlyBlock(header) {
+				d, started, ended := drift.observe(header, time.Now())
+				sess.setDrift(d, driftLevel(d, cfg.driftMax))
+				if started {
+					anomalies.record(anomalyDrift, header.Number.Uint64(), fmt.Sprintf("heads are %+.1fs off their timestamps, check the clocks of the node and this machine", d.Seconds()))
+				}
+				if ended {
+					console.writef("OK: Clock drift back to %+.1fs", d.Seconds())
+				}
 			}
+			if idle != nil {
+				if !idleTimer.Stop() {
+					<-idleTimer.C
+				}
+				idleTimer.Reset(cfg.idleExit)
+			}
+			if pressure.observe(len(ch), cap(ch)) {
+				anomalies.recordf(anomalyLag, "UI is lagging the node, head buffer %d/%d full (dropped %d heads), raise -head-buffer to absorb bursts", len(ch), cap(ch), sess.droppedHeads())
+			}
+			if gapFill {
+				// the new subscription delivers, retries start over
+				resubscribes.reset()
+			}
+			repeat, loop, low, high := loops.observe(header)
+			if loop {
+				anomalies.record(anomalyLoop, high, fmt.Sprintf("node appears to be looping over blocks %d-%d", low, high))
+			}
+			if repeat {
+				sess.repeatHead()
+				hash := header.Hash()
+				console.logf(msgDebug, "Repeated head: %s %x announced %d times", formatBlockNumber(header.Number), hash[:4], loops.announcements(hash))
+				continue
+			}
+			// only advancing heads count as arrivals, a looping node isn't
+			// healthy
+			sess.arrived(time.Now())
+			if following() != followLatest {
+				// the tagged blocks are polled instead
+				gapFill = false
+				continue
+			}
+			if tag != followLatest {
+				tag, lastHeader = followLatest, nil
+				console.writeln("OK: Following the latest head")
+			}
+			if gapFill && lastHeader != nil {
+				gapFill = false
 
-			gasLimit = append(gasLimit, int(header.GasLimit.Div(header.GasLimit, million).Uint64()))
-			gasGraph.Lines[0].Data = gasLimit
-
-			if len(gasUsed) == 100 {
-				gasUsed = gasUsed[1:]
+				headers, truncated, missing, err := fillGap(ctx, client, lastHeader.Number, header.Number)
+				if err != nil {
+					console.alert(levelBad, fmt.Sprint("gap fill failed: ", err))
+				}
+				if truncated {
+					console.writef("Gap fill truncated to the last %d blocks", maxGapFill)
+				}
+				if len(headers) > 0 {
+					console.writef("Filled gap of %d blocks", len(headers))
+				}
+				if missing > 0 {
+					console.writef("Gap fill: %d blocks unavailable on this node", missing)
+				}
+				for _, h := range headers {
+					process(h)
+				}
+			}
+			process(header)
+		case <-followTick.C:
+			next := following()
+			if next == followLatest {
+				continue
+			}
+			header, err := fetchTagged(ctx, rpcClient, next)
+			if err != nil {
+				console.alert(levelWarn, fmt.Sprintf("can't follow the %s blocks, following the latest head: %v", next, err))
+				setFollow(followLatest)
+				continue
+			}
+			if next != tag {
+				// the graphs start over rather than measuring from the
+				// latest head back to the tagged block
+				tag, lastHeader = next, nil
+				console.writef("OK: Following the %s blocks, at %s", tag, formatBlockNumber(header.Number))
+			}
+			if lastHeader != nil && header.Number.Cmp(lastHeader.Number) <= 0 {
+				continue
+			}
+			process(header)
+		case <-feeTick:
+			hist, err := fetchFeeHistory(ctx, rpcClient, cfg.feeHistory, cfg.rewardPcts)
+			if err != nil {
+				console.alert(levelWarn, fmt.Sprint("failed to fetch the fee history: ", err))
+				continue
+			}
+			updateFeeHistoryGraph(dash.feeHist, hist, cfg.rewardPcts)
+			if !feeHistSeen {
+				feeHistSeen = true
+				dash.reveal("feehistory")
 			}
+			dash.touch(dash.feeHist)
+		case <-peerTick:
+			var count int
+			if cfg.peers {
+				count, err = peers.poll(ctx, dash, sess)
+			} else {
+				count, err = fetchPeerCount(ctx, rpcClient)
+			}
+			if err != nil {
+				console.writeln("Peers: net_peerCount unavailable, stopped polling: ", err)
+				peerTick = nil
+				continue
+			}
+			peerCount = count
+			metrics.setPeers(count)
+		case <-idle:
+			console.writef("Idle timeout, exiting: no head within %v", cfg.idleExit)
+			return errIdle
+		case <-noHeadsC:
+			if subFlowing.on() {
+				continue
+			}
+			anomalies.recordf(anomalyStall, "no heads received within %v, falling back to polling", cfg.headTimeout)
+			pollCh := make(chan *types.Header)
+			go forwardHeads(ctx, pollCh, ch, sess, nil)
+			go pollHeads(ctx, client, pollCh, subFlowing.on, newBackoff(cfg.backoffInitial, cfg.backoffMax), console)
+		case err := <-subErr:
+			sess.disconnected(time.Now())
+			anomalies.recordf(anomalyDisconnect, "subscription dropped, retrying with backoff: %v", err)
+			newSub, err := resubscribe(ctx, client, subCh, resubscribes, console)
+			if err != nil {
+				return err
+			}
+			sub, subErr = newSub, newSub.Err()
+			sess.reconnected()
+			console.writeln("OK: Resubscribed to new heads")
+			gapFill = true
+		}
+	}
+}
 
-			gasUsed = append(gasUsed, int(header.GasUsed.Div(header.GasUsed, big.NewInt(100)).Uint64()))
-			gasGraph.Lines[1].Data = gasUsed
+var (
+	themeFlag             = flag.String("theme", "default", "colour theme: default or colorblind")
+	backgroundFlag        = flag.String("background", backgroundAuto, "terminal background the colours are chosen for: dark, light or auto (from COLORFGBG, dark if unknown)")
+	configFlag            = flag.String("config", "", "JSON, TOML (.toml) or YAML (.yaml) file with flag values, default $MONETH_CONFIG or else ~/.config/moneth/config.{json,toml,yaml} if present; command line flags take precedence")
+	versionFlag           = flag.Bool("version", false, "print the version and build information and exit")
+	printConfigFlag       = flag.Bool("print-config", false, "print the effective configuration as JSON and exit")
+	precisionFlag         = flag.Int("precision", 2, "decimal places of derived metrics (0-8)")
+	blockFormatFlag       = flag.String("block-format", numberDecimal, "block number display format: decimal, grouped or hex (cycle with b)")
+	historyFlag           = flag.Int("history", maxSamples, "number of blocks the header, withdrawal and token caches keep before evicting the oldest")
+	sampleFlag            = flag.String("sample", "1", "number of blocks, or span of block time such as 30s, aggregated into a single graph point")
+	panelsFlag            = flag.String("panels", "gas,caps,blocktime,rate,gascmp,txgas,toptx,alerts,anomalies,console,status", "comma separated list of panels shown at launch, e.g. add gasprice for the gas weighted price")
+	scaleFlag             = flag.String("scale", scaleRaw, "gas used scaling: raw, rollingmax or absolute")
+	renderFlag            = flag.String("render", renderBlocks, "renderer of the gas and block time graphs: blocks or braille (needs a font with braille glyphs)")
+	graphStyleFlag        = flag.String("graph-style", styleBars, "style graphs are drawn in: bars or line (toggle with g)")
+	minimalFlag           = flag.Bool("minimal", false, "draw the console and the gas and block time graphs without borders, the graph labels taking their first row")
+	csvFlag               = flag.String("csv", "", "file every block is exported to as CSV")
+	logFlag               = flag.String("log", "", "file the console messages are written to")
+	compressFlag          = flag.Bool("compress", false, "gzip compress the CSV and log files")
+	fetchFlag             = flag.Bool("fetch", false, "fetch full blocks to compute per transaction metrics")
+	trimFlag              = flag.Int("trim", 10, "percentage of the lowest and highest block times discarded by the trimmed mean (0-49)")
+	receiptsFlag          = flag.Bool("receipts", false, "fetch receipts along with full blocks (implies -fetch)")
+	headBufferFlag        = flag.Int("head-buffer", defaultHeadBuffer, "number of heads buffered between the subscription and the UI; larger values absorb bursts and stalls at the cost of memory")
+	l1Flag                = flag.String("l1", "", "L1 endpoint used to watch the rollup's postings")
+	l1ContractFlag        = flag.String("l1-contract", "", "L1 contract the rollup posts batches or state roots to")
+	l1TopicFlag           = flag.String("l1-topic", "", "optional event signature hash the L1 postings are filtered on")
+	txPoolFlag            = flag.Bool("txpool", false, "poll txpool_status into the txpool and poolusage panels")
+	txPoolSlotsFlag       = flag.Int("txpool-slots", defaultPoolSlots, "capacity of the node's transaction pool the pool usage is relative to")
+	tokenFlag             = flag.String("token", "", "ERC-20 contract whose transfer volume is watched")
+	blockTimeFlag         = flag.Duration("block-time", 0, "expected block interval of the chain (0 = detect from recent blocks)")
+	headTimeoutFlag       = flag.Duration("head-timeout", time.Minute, "fall back to polling if the subscription delivers no head within this time")
+	gasLevelsFlag         = flag.String("gaslimit-levels", "15M,30M,36M,45M,60M", "comma separated gas limits whose crossing is highlighted")
+	peersFlag             = flag.Bool("peers", false, "poll net_peerCount and admin_peers into the peers and peerlist panels")
+	feeHistoryFlag        = flag.Int("fee-history", 0, "blocks of eth_feeHistory shown in the feehistory panel, refreshed every block time (0 = off)")
+	rewardPercentilesFlag = flag.String("fee-history-percentiles", "10,50,90", "comma separated reward percentiles requested from eth_feeHistory")
+	feePercentilesFlag    = flag.String("fee-percentiles", "", "comma separated percentiles of the gas prices paid in recent fetched blocks, e.g. 10,50,90")
+	overlayFlag           = flag.String("overlay", "", "comma separated series overlaid in one graph: gasused,utilisation,blocktime,basefee,gasprice")
+	overlayMinMaxFlag     = flag.Bool("overlay-minmax", false, "scale every overlaid series between its own window minimum and maximum")
+	tabsFlag              = flag.String("tabs", "", "semicolon separated tabs of panels switched with [ and ], e.g. fees=gas,gasprice;events=anomalies,console")
+	pauseOnFlag           = flag.String("pause-on", "", "comma separated anomaly kinds pausing the display, e.g. spike,loop,rule")
+	gasMaxFlag            = flag.Uint64("gas-max", 0, "pin the gas used graph to this maximum (0 = auto scale)")
+	blockTimeMaxFlag      = flag.Int("blocktime-max", 0, "pin the block time graph to this maximum in the block time unit (0 = auto scale)")
+	blockTimeUnitFlag     = flag.String("blocktime-unit", "s", "unit block times are plotted and reported in: s or ms")
+	fullRedrawFlag        = flag.Bool("full-redraw", false, "redraw the whole dashboard every tick rather than only changed widgets")
+	utilisationDecayFlag  = flag.Float64("utilisation-decay", 0.01, "weight of the newest block in the long-term gas used average shown with u (smaller is slower)")
+	spikeFlag             = flag.Float64("fee-spike", 100, "fee rise in percent reported as a fee spike, in the base fee of -fetch or with -fee-spike-gasprice (0 = off)")
+	spikeBlocksFlag       = flag.Int("fee-spike-blocks", 3, "number of blocks a fee spike is measured over")
+	spikeLogFlag          = flag.String("fee-spike-log", "", "file fee spikes are appended to along with the surrounding blocks")
+	spikePriceFlag        = flag.Bool("fee-spike-gasprice", false, "detect fee spikes in eth_gasPrice, requested every block, while no base fee is fetched")
+	healthAddrFlag        = flag.String("health-addr", "", "address serving the /healthz and /readyz checks, e.g. :8080")
+	metricsListenFlag     = flag.String("metrics-listen", "", "address serving the block height, gas, block time and peer count as Prometheus metrics on /metrics, e.g. :9090")
+	headlessFlag          = flag.Bool("headless", false, "run without the dashboard and stream the blocks as JSON lines, e.g. under systemd without a TTY")
+	headlessOutFlag       = flag.String("headless-out", "", "file the JSON lines of -headless are written to (default stdout)")
+	consoleHideFlag       = flag.String("console-hide", "", "comma separated console message categories hidden at launch: block,alert,info,debug")
+	consoleMaxFlag        = flag.Int("console-max", 15, "height the console expands to while there are unread warnings (0 = fixed)")
+	heightsFlag           = flag.String("heights", "", "comma separated panel heights in rows overriding the defaults, e.g. gas=24,console=10")
+	pollIntervalFlag      = flag.Duration("poll-interval", pollInterval, "time between two polls for the latest header without a head subscription, and for followed safe or finalized blocks")
+	tipIntervalFlag       = flag.Duration("tip-interval", tipInterval, "time between two requests for the tip of the node")
+	peerIntervalFlag      = flag.Duration("peer-interval", peerInterval, "time between two requests for the peers of the node")
+	syncIntervalFlag      = flag.Duration("sync-interval", syncInterval, "time between two requests for the sync progress")
+	txPoolIntervalFlag    = flag.Duration("txpool-interval", txPoolInterval, "time between two requests for the transaction pool status")
+	buildersFlag          = flag.String("builders", "", "JSON file of builder tags labelling blocks by coinbase or extra data")
+	recipientNamesFlag    = flag.String("recipient-names", "", "JSON file mapping withdrawal recipient addresses to names")
+	emitSocketFlag        = flag.String("emit-socket", "", "Unix socket the block events are streamed to as JSON lines")
+	webFlag               = flag.String("web", "", "address serving a self refreshing HTML mirror of the dashboard, e.g. :8080")
+	rulesFlag             = flag.String("rules", "", "JSON file with rules flagging interesting blocks")
+	ruleWebhookFlag       = flag.String("rule-webhook", "", "URL rule matches are posted to as JSON")
+	insecureFlag          = flag.Bool("insecure", false, "skip the TLS certificate verification of https and wss endpoints, e.g. for self-signed dev nodes, and of the rule webhook")
+	driftMaxFlag          = flag.Duration("drift-max", 15*time.Second, "median delay of heads behind their timestamps warned about as clock drift")
+	backoffInitialFlag    = flag.Duration("backoff-initial", time.Second, "first delay before retrying a failed resubscription or poll, doubled up to -backoff-max")
+	backoffMaxFlag        = flag.Duration("backoff-max", 30*time.Second, "maximum delay between retries of a failed resubscription or poll")
+	idleExitFlag          = flag.Duration("idle-exit", 0, "exit with code 3 if no head arrives for this long, or with code 1 if the node can't be reached for this long (0 = never)")
+	stateFlag             = flag.String("state", "", "JSON file keeping the stats of every endpoint across sessions")
+	reportFlag            = flag.String("report", "", "file the session summary is written to on exit (default stdout)")
+)
 
-			if lastHeader != nil {
-				time := new(big.Int).Sub(header.Time, lastHeader.Time)
-				blockTime = append(blockTime, int(time.Uint64()))
-			}
-			blockTimeGraph.Lines[0].Data = blockTime
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [flags] [endpoint...]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "The endpoint is an IPC socket path, optionally prefixed with ipc://, or an")
+		fmt.Fprintln(os.Stderr, "http://, https://, ws:// or wss:// URL. Nodes that can't push new heads, e.g.")
+		fmt.Fprintln(os.Stderr, "over HTTP, are polled. With several endpoints the dashboard follows the first")
+		fmt.Fprintln(os.Stderr, "one and a nodes panel compares the heads, peers and gas of all of them.")
+		fmt.Fprintln(os.Stderr)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 
-			hash := header.Hash()
-			console.writef("Added block: %d %x", header.Number, hash[:4])
+	if *versionFlag {
+		fmt.Println(buildInfo())
+		return
+	}
 
-			lastHeader = header
-		case err := <-sub.Err():
-			panic(err)
+	// resolve the settings: command line flags take precedence over the
+	// environment, which takes precedence over the config file
+	explicit := commandLineFlags()
+	var fileEndpoint string
+	*configFlag = configPath(*configFlag, explicit)
+	if *configFlag != "" {
+		var err error
+		if fileEndpoint, err = applyConfigFile(*configFlag, explicit); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
 		}
 	}
-}
+	envEndpoint, err := applyEnv(explicit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	endpoint := flag.Arg(0)
+	if endpoint == "" {
+		endpoint = envEndpoint
+	}
+	if endpoint == "" {
+		endpoint = fileEndpoint
+	}
+	if *printConfigFlag {
+		if err := printConfig(os.Stdout, endpoint); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if endpoint == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	endpoints := []string{endpoint}
+	if flag.NArg() > 1 {
+		endpoints = flag.Args()
+	}
+	for _, e := range endpoints {
+		if _, err := endpointTransport(e); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	insecureTLS = *insecureFlag
+	if insecureTLS {
+		skipTLSVerify()
+	}
+	if *precisionFlag < 0 || *precisionFlag > 8 {
+		fmt.Fprintf(os.Stderr, "invalid precision %d: must be between 0 and 8\n", *precisionFlag)
+		os.Exit(1)
+	}
+	precision = *precisionFlag
+	if *historyFlag < 2 {
+		fmt.Fprintf(os.Stderr, "invalid history %d: must be at least 2 blocks\n", *historyFlag)
+		os.Exit(1)
+	}
+	setHistoryLimit(*historyFlag)
+	if err := numbering.setStyle(*blockFormatFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	sampleSize, sampleSpan, err := parseSample(*sampleFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("usage: %s /path/to/socket\n", os.Args[0])
+	if err := validScale(*scaleFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := validGraphStyle(*graphStyleFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	graphStyle = *graphStyleFlag
+	minimal = *minimalFlag
+	if err := validRenderer(*renderFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := validBlockTimeUnit(*blockTimeUnitFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	blockTimeUnit = *blockTimeUnitFlag
+	if *trimFlag < 0 || *trimFlag > 49 {
+		fmt.Fprintf(os.Stderr, "invalid trim %d: must be between 0 and 49\n", *trimFlag)
+		os.Exit(1)
+	}
+	if *headBufferFlag < 1 {
+		fmt.Fprintf(os.Stderr, "invalid head buffer %d: must be at least 1\n", *headBufferFlag)
+		os.Exit(1)
+	}
+	for name, d := range map[string]time.Duration{
+		"poll": *pollIntervalFlag, "tip": *tipIntervalFlag, "peer": *peerIntervalFlag,
+		"sync": *syncIntervalFlag, "txpool": *txPoolIntervalFlag,
+	} {
+		if d <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid %s interval %v: must be positive\n", name, d)
+			os.Exit(1)
+		}
+	}
+	pollInterval, tipInterval, peerInterval = *pollIntervalFlag, *tipIntervalFlag, *peerIntervalFlag
+	syncInterval, txPoolInterval = *syncIntervalFlag, *txPoolIntervalFlag
+	if *backoffInitialFlag <= 0 || *backoffMaxFlag < *backoffInitialFlag {
+		fmt.Fprintf(os.Stderr, "invalid backoff %v up to %v: must be positive and the maximum at least the initial delay\n", *backoffInitialFlag, *backoffMaxFlag)
+		os.Exit(1)
+	}
+	if *blockTimeFlag < 0 {
+		fmt.Fprintf(os.Stderr, "invalid block time %v: must not be negative\n", *blockTimeFlag)
+		os.Exit(1)
+	}
+	if *utilisationDecayFlag <= 0 || *utilisationDecayFlag > 1 {
+		fmt.Fprintf(os.Stderr, "invalid utilisation decay %v: must be above 0 and at most 1\n", *utilisationDecayFlag)
+		os.Exit(1)
+	}
+	if *spikeFlag < 0 || *spikeBlocksFlag < 1 {
+		fmt.Fprintf(os.Stderr, "invalid fee spike %v%% over %d blocks\n", *spikeFlag, *spikeBlocksFlag)
+		os.Exit(1)
+	}
+	cfg := &config{
+		path:         endpoint,
+		sampleSize:   sampleSize,
+		sampleSpan:   sampleSpan,
+		scale:        *scaleFlag,
+		fetch:        *fetchFlag || *receiptsFlag,
+		receipts:     *receiptsFlag,
+		trim:         *trimFlag,
+		headBuffer:   *headBufferFlag,
+		gasMax:       *gasMaxFlag,
+		blockTimeMax: *blockTimeMaxFlag,
+		headTimeout:  *headTimeoutFlag,
+		idleExit:     *idleExitFlag,
+		driftMax:     *driftMaxFlag,
+
+		backoffInitial: *backoffInitialFlag,
+		backoffMax:     *backoffMaxFlag,
+		blockTime:      *blockTimeFlag,
+		spikePct:       *spikeFlag,
+
+		utilisationDecay: *utilisationDecayFlag,
+		spikeBlocks:      *spikeBlocksFlag,
+		spikeLog:         *spikeLogFlag,
+		spikePrice:       *spikePriceFlag,
+		ruleWebhook:      *ruleWebhookFlag,
+		statePath:        *stateFlag,
+		peers:            *peersFlag,
+	}
+	if cfg.gasLevels, err = parseGasLevels(*gasLevelsFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if cfg.feePercentiles, err = parsePercentiles(*feePercentilesFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *feeHistoryFlag < 0 || *feeHistoryFlag > maxFeeHistory {
+		fmt.Fprintf(os.Stderr, "invalid fee history %d: must be between 0 and %d blocks\n", *feeHistoryFlag, maxFeeHistory)
+		os.Exit(1)
+	}
+	cfg.feeHistory = *feeHistoryFlag
+	if cfg.rewardPcts, err = parsePercentiles(*rewardPercentilesFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if cfg.overlay, err = parseOverlay(*overlayFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *recipientNamesFlag != "" {
+		names, err := loadRecipientNames(*recipientNamesFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.recipientNames = names
+	}
+	if *buildersFlag != "" {
+		if builders, err = loadBuilders(*buildersFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if *rulesFlag != "" {
+		rules, err := loadRules(*rulesFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		cfg.rules = rules
+	}
+
+	var l1 *l1Watcher
+	if *l1Flag != "" {
+		if !common.IsHexAddress(*l1ContractFlag) {
+			fmt.Fprintf(os.Stderr, "invalid L1 contract %q\n", *l1ContractFlag)
+			os.Exit(1)
+		}
+		var topic *common.Hash
+		if *l1TopicFlag != "" {
+			h := common.HexToHash(*l1TopicFlag)
+			topic = &h
+		}
+		l1 = newL1Watcher(*l1Flag, common.HexToAddress(*l1ContractFlag), topic)
+	}
+
+	var token *tokenWatcher
+	if *tokenFlag != "" {
+		if !common.IsHexAddress(*tokenFlag) {
+			fmt.Fprintf(os.Stderr, "invalid token contract %q\n", *tokenFlag)
+			os.Exit(1)
+		}
+		token = newTokenWatcher(endpoint, common.HexToAddress(*tokenFlag))
+	}
+
+	if err := setTheme(*themeFlag, *backgroundFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	dash := newDashboard()
+	if err := dash.setHeights(*heightsFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	dash.console.setExpansion(*consoleMaxFlag)
+	if err := dash.console.hide(*consoleHideFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *renderFlag == renderBraille {
+		dash.gas.Braille, dash.blockTime.Braille = true, true
+	}
+	if err := dash.enable(*panelsFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := dash.parseTabs(*tabsFlag); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	if *pauseOnFlag != "" {
+		pauseOn, err := parseAnomalyKinds(*pauseOnFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		dash.anomalies.onEvent = func(event anomaly) {
+			if pauseOn[event.kind] {
+				dash.pause(event.kind + ": " + event.detail)
+			}
+		}
+	}
+	if len(cfg.overlay) > 0 {
+		*dash.overlay = *newOverlayGraph(cfg.overlay, *overlayMinMaxFlag)
+		dash.show("overlay")
+	}
+	if len(cfg.feePercentiles) > 0 {
+		dash.fees.Height = len(cfg.feePercentiles) + 2
+		dash.show("fees")
+	}
+	addRewardLines(dash.feeHist, cfg.rewardPcts)
+	if l1 != nil {
+		dash.show("l1")
+	}
+	if token != nil {
+		dash.show("token")
+	}
+	var pool *txPoolWatcher
+	if *txPoolFlag {
+		if *txPoolSlotsFlag < 1 {
+			fmt.Fprintf(os.Stderr, "invalid tx pool slots %d: must be at least 1\n", *txPoolSlotsFlag)
+			os.Exit(1)
+		}
+		pool = newTxPoolWatcher(endpoint, *txPoolSlotsFlag)
+		dash.show("txpool")
+		dash.show("poolusage")
+	}
 
-	if err := ui.Init(); err != nil {
-		panic(err)
+	var nodes []*nodeCollector
+	if len(endpoints) > 1 {
+		for _, e := range endpoints {
+			nodes = append(nodes, newNodeCollector(e))
+		}
+		dash.nodes.Height = len(nodes) + 2
+		dash.show("nodes")
 	}
-	defer ui.Close()
 
-	fmt.Println("initialising...")
+	var exp *exporter
+	if *csvFlag != "" {
+		var err error
+		if exp, err = newExporter(*csvFlag, *compressFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to create CSV export:", err)
+			os.Exit(1)
+		}
+	}
+	var logFile io.WriteCloser
+	if *logFlag != "" {
+		var err error
+		if logFile, err = openOutput(*logFlag, *compressFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to create log file:", err)
+			os.Exit(1)
+		}
+		dash.console.setLog(logFile)
+	}
 
-	sp := newGasGraph()
-	bt := newBlockTimeGraph()
+	var events *eventSocket
+	if *emitSocketFlag != "" {
+		var err error
+		if events, err = listenEvents(*emitSocketFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to create event socket:", err)
+			os.Exit(1)
+		}
+	}
 
-	console := newConsole(7)
+	var healthListener net.Listener
+	if *healthAddrFlag != "" {
+		var err error
+		if healthListener, err = net.Listen("tcp", *healthAddrFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to listen for health checks:", err)
+			os.Exit(1)
+		}
+	}
 
-	// build layout
-	ui.Body.AddRows(
-		ui.NewRow(
-			ui.NewCol(6, 0, sp),
-			ui.NewCol(6, 0, bt),
-		),
-		ui.NewRow(ui.NewCol(12, 0, console)),
+	var metrics *chainMetrics
+	var metricsListener net.Listener
+	if *metricsListenFlag != "" {
+		var err error
+		if metricsListener, err = net.Listen("tcp", *metricsListenFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to listen for metrics:", err)
+			os.Exit(1)
+		}
+		metrics = newChainMetrics()
+	}
+
+	var webListener net.Listener
+	if *webFlag != "" {
+		var err error
+		if webListener, err = net.Listen("tcp", *webFlag); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to listen for the web dashboard:", err)
+			os.Exit(1)
+		}
+	}
+
+	// headless mode keeps the dashboard off screen, the widgets are still
+	// updated but never drawn
+	var lines *jsonLines
+	var linesFile io.WriteCloser
+	if *headlessFlag {
+		out := io.Writer(os.Stdout)
+		if *headlessOutFlag != "" {
+			var err error
+			if linesFile, err = openOutput(*headlessOutFlag, *compressFlag); err != nil {
+				fmt.Fprintln(os.Stderr, "failed to open JSON lines output:", err)
+				os.Exit(1)
+			}
+			out = linesFile
+		}
+		lines = newJSONLines(out)
+		if logFile == nil {
+			dash.console.setLog(os.Stderr)
+		}
+	} else {
+		if err := ui.Init(); err != nil {
+			panic(err)
+		}
+
+		// build layout
+		dash.layout()
+		dash.render()
+	}
+
+	sess := newSession()
+	dash.console.sess = sess
+
+	// splash until the first block arrives
+	dash.console.writeln(buildInfo())
+	if insecureTLS {
+		dash.console.alert(levelWarn, "TLS certificate verification is disabled by -insecure")
+	}
+	dash.console.writeln("Connecting to ", redactEndpoint(endpoint), "...")
+	dash.status.Text = "waiting for the first head from " + redactEndpoint(endpoint) + "..."
+	if !*headlessFlag {
+		dash.render()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	var (
+		idled  toggle
+		failed error // why run gave up, read once done is closed
 	)
+	go func() {
+		defer close(done)
+		err := run(ctx, cfg, dash, sess, exp, events, metrics, lines)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		lines.writeError(err)
+		if err == errIdle {
+			idled.set(true)
+		} else {
+			failed = err
+		}
+		if !*headlessFlag {
+			ui.StopLoop()
+		}
+	}()
+	if l1 != nil {
+		dash.l1.Text = "waiting for the first posting..."
+		go l1.watch(ctx, sess, dash.console)
+	}
+	if token != nil {
+		go token.watch(ctx, dash.console)
+	}
+	if pool != nil {
+		go pool.watch(ctx, dash.console)
+	}
+	for _, n := range nodes {
+		go n.collect(ctx, newBackoff(cfg.backoffInitial, cfg.backoffMax))
+	}
+	if healthListener != nil {
+		go serveHealth(healthListener, sess, dash.console)
+	}
+	if metricsListener != nil {
+		go serveMetrics(metricsListener, metrics, dash.console)
+	}
+	if webListener != nil {
+		go serveWeb(webListener, sess, dash.console)
+	}
+	if events != nil {
+		go events.serve(dash.console)
+	}
 
-	go run(os.Args[1], console, sp, bt)
+	if *headlessFlag {
+		waitHeadless(done)
+	} else {
+		handleEvents(ctx, cfg, dash, sess, l1, token, pool, nodes)
+		ui.Loop()
+	}
+
+	// stop the monitor and give it a moment to release the subscription
+	cancel()
+	var runErr error
+	select {
+	case <-done:
+		runErr = failed
+	case <-time.After(shutdownTimeout):
+	}
+	if !*headlessFlag {
+		ui.Close()
+	}
+
+	events.Close()
+	if err := exp.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to close CSV export:", err)
+	}
+	if linesFile != nil {
+		if err := linesFile.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to close JSON lines output:", err)
+		}
+	}
+	if logFile != nil {
+		dash.console.setLog(nil)
+		if err := logFile.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to close log file:", err)
+		}
+	}
+
+	if cfg.statePath != "" {
+		if err := persistSession(cfg.statePath, sess); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to update the state file:", err)
+		}
+	}
+	// keep stdout to the JSON lines in headless mode
+	if *headlessFlag && *headlessOutFlag == "" && *reportFlag == "" {
+		sess.report(os.Stderr)
+	} else if err := writeReport(*reportFlag, sess); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write session report:", err)
+		os.Exit(1)
+	}
+	if idled.on() {
+		fmt.Fprintln(os.Stderr, "idle timeout, exiting")
+		os.Exit(exitIdle)
+	}
+	if runErr != nil {
+		fmt.Fprintln(os.Stderr, "moneth:", runErr)
+		os.Exit(1)
+	}
+}
 
-	handleEvents()
+// writeReport writes the session summary to the given file, or to stdout if
+// no file is given.
+func writeReport(path string, sess *session) error {
+	if path == "" {
+		sess.report(os.Stdout)
+		return nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	sess.report(f)
 
-	ui.Loop()
+	return f.Close()
 }
 
-func handleEvents() {
-	// calculate layout
-	ui.Body.Align()
+func handleEvents(ctx context.Context, cfg *config, dash *dashboard, sess *session, l1 *l1Watcher, token *tokenWatcher, pool *txPoolWatcher, nodes []*nodeCollector) {
+	dash.handleToggles()
+	dash.handleTabs()
 
-	ui.Handle("/sys/kbd/q", func(ui.Event) {
+	dash.handleKey("q", func() {
 		ui.StopLoop()
 	})
+	dash.handleKey("u", func() {
+		// run owns the lines of the gas graph, it adds or removes the
+		// percentage lines with the next block
+		if dash.showPercent.flip() {
+			dash.console.writeln("Gas: showing the gas used percentage from the next block")
+		} else {
+			dash.console.writeln("Gas: hiding the gas used percentage from the next block")
+		}
+	})
+	dash.handleKey("v", func() {
+		percent := dash.gas.ShowAlt.flip()
+		if h := sess.head(); h != nil {
+			dash.gas.BorderLabel = gasLabel(h, percent)
+		}
+		dash.touch(dash.gas)
+	})
+	dash.handleKey("t", func() {
+		if dash.showTrimmed.flip() {
+			dash.console.writeln("Block time: showing trimmed mean")
+		} else {
+			dash.console.writeln("Block time: hiding trimmed mean")
+		}
+	})
+	dash.handleKey("n", func() {
+		if numbering.toggle() {
+			dash.console.writeln("Block numbers: relative to session start")
+		} else {
+			dash.console.writeln("Block numbers: absolute")
+		}
+	})
+	dash.handleKey("b", func() {
+		dash.console.writeln("Block numbers: ", numbering.cycleStyle())
+	})
+	dash.handleKey("d", func() {
+		if dash.details.visible {
+			dash.details.visible = false
+			ui.Clear()
+		} else if head := sess.head(); head != nil {
+			dash.details.show(head, sess.block(head))
+		}
+		dash.render()
+	})
+	dash.handleKey("w", func() {
+		if !dash.details.visible {
+			return
+		}
+		name, err := dash.details.write()
+		if err != nil {
+			dash.console.writeln("Failed to write block details: ", err)
+			return
+		}
+		dash.console.writeln("Wrote block details to ", name)
+	})
+
+	var commands map[string]command
+	commands = map[string]command{
+		"help": {"help                  list the commands", func([]string) error {
+			for _, usage := range commandHelp(commands) {
+				dash.console.writeln(usage)
+			}
+			return nil
+		}},
+		"watch": {"watch <token>         watch the transfers of an ERC-20 token", func(args []string) error {
+			if len(args) != 1 || !common.IsHexAddress(args[0]) {
+				return errors.New("usage: watch <token address>")
+			}
+			if token != nil {
+				return fmt.Errorf("already watching token %s", token.contract.Hex())
+			}
+			token = newTokenWatcher(cfg.path, common.HexToAddress(args[0]))
+			go token.watch(ctx, dash.console)
+
+			dash.show("token")
+			dash.layout()
+			ui.Clear()
+			dash.render()
+			return nil
+		}},
+		"window": {"window <blocks>       number of points kept for each graph", func(args []string) error {
+			var n int
+			if len(args) != 1 {
+				return errors.New("usage: window <blocks>")
+			}
+			if _, err := fmt.Sscan(args[0], &n); err != nil || n < 2 || n > 10*maxSamples {
+				return fmt.Errorf("invalid window %q: must be between 2 and %d", args[0], 10*maxSamples)
+			}
+			setGraphWindow(n)
+			dash.console.writef("Graph window: %d points", n)
+			return nil
+		}},
+		"export": {"export                write the details of the head block to a file", func([]string) error {
+			head := sess.head()
+			if head == nil {
+				return errors.New("no block received yet")
+			}
+			name, err := writeBlockDetails(head, blockDetails(head, sess.block(head)))
+			if err != nil {
+				return err
+			}
+			dash.console.writeln("Wrote block details to ", name)
+			return nil
+		}},
+		"windows": {"windows               write the blocks of the graph window to a JSON file", func([]string) error {
+			name, err := sess.exportWindows()
+			if err != nil {
+				return err
+			}
+			dash.console.writeln("Wrote the graph window to ", name)
+			return nil
+		}},
+		"follow": {"follow <tag>          follow the latest, safe or finalized blocks", func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: follow latest|safe|finalized")
+			}
+			if err := setFollow(args[0]); err != nil {
+				return err
+			}
+			dash.console.writef("Following the %s blocks from the next one", args[0])
+			return nil
+		}},
+		"hide": {"hide <category>       hide console messages: block, alert, info or debug", func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: hide <category>")
+			}
+			return dash.console.setHidden(args[0], true)
+		}},
+		"show": {"show <category>       show hidden console messages again", func(args []string) error {
+			if len(args) != 1 {
+				return errors.New("usage: show <category>")
+			}
+			return dash.console.setHidden(args[0], false)
+		}},
+		"quit": {"quit                  exit the monitor", func([]string) error {
+			ui.StopLoop()
+			return nil
+		}},
+	}
+	dash.handleCommands(commands)
+	dash.handleKey("<up>", func() {
+		dash.anomalies.move(-1)
+		dash.touch(dash.anomalies)
+	})
+	dash.handleKey("<down>", func() {
+		dash.anomalies.move(1)
+		dash.touch(dash.anomalies)
+	})
+	dash.handleKey("<enter>", func() {
+		event, ok := dash.anomalies.current()
+		if !ok || !event.hasBlock {
+			return
+		}
+		header := sess.header(event.block)
+		if header == nil {
+			dash.console.writef("Block #%s is no longer in the session history", formatBlockUint(event.block))
+			return
+		}
+		dash.details.show(header, sess.block(header))
+		dash.render()
+	})
+	dash.handleKey("g", func() {
+		dash.toggleGraphStyles()
+		dash.render()
+	})
+	dash.handleKey("x", func() {
+		header, ok := dash.extremes.next()
+		if !ok {
+			return
+		}
+		dash.details.show(header, sess.block(header))
+		dash.render()
+	})
+	dash.handleKey("p", func() {
+		if paused, _ := dash.pauseState(); paused {
+			dash.resume()
+			ui.Clear()
+			dash.render()
+			return
+		}
+		dash.pause("paused by hand")
+		dash.render()
+	})
+	dash.handleKey("j", func() {
+		name, err := sess.dump()
+		if err != nil {
+			dash.console.writeln("Failed to dump the graph series: ", err)
+			return
+		}
+		dash.console.writeln("Dumped the graph series to ", name)
+	})
+	dash.handleKey("c", func() {
+		summary := sess.summary()
+		if err := copyToClipboard(summary); err != nil {
+			dash.console.writeln("Summary (", err, "): ", summary)
+			return
+		}
+		dash.console.writeln("Copied summary to the clipboard: ", summary)
+	})
+	dash.handleKey("a", func() {
+		dash.console.ack()
+	})
+	dash.handleKey("e", func() {
+		if dash.console.toggleExpansion() {
+			dash.console.writeln("Console: expanding with unread alerts, acknowledge with a")
+		} else {
+			dash.console.writeln("Console: fixed height")
+		}
+	})
 	ui.Handle("/timer/1s", func(e ui.Event) {
-		ui.Render(ui.Body)
+		dash.status.update(sess)
+		dash.extremes.update(sess.allExtremes())
+		dash.touch(dash.status, dash.alerts, dash.anomalies, dash.extremes)
+		if head := sess.head(); l1 != nil && head != nil {
+			dash.l1.Text = l1.summary(head.Number.Uint64())
+			dash.touch(dash.l1)
+		}
+		if token != nil {
+			token.update(dash.token)
+			dash.touch(dash.token)
+		}
+		if pool != nil && pool.update(dash.txPool, dash.poolUsage) {
+			dash.touch(dash.txPool, dash.poolUsage)
+		}
+		if nodes != nil {
+			updateNodesList(dash.nodes, nodes)
+			dash.touch(dash.nodes)
+		}
+
+		if paused, _ := dash.pauseState(); paused {
+			// keep the frozen display, the changes are drawn on resume
+			dash.renderOverlays()
+		} else if revealed, synced := dash.applyReveals(), dash.emphasizeSync(sess.syncProgress()); dash.fitConsole() || revealed || synced {
+			dash.layout()
+			ui.Clear()
+			dash.render()
+		} else if *fullRedrawFlag {
+			dash.render()
+		} else {
+			dash.renderDirty()
+		}
 	})
 
 	ui.Handle("/sys/wnd/resize", func(e ui.Event) {
 		ui.Body.Width = ui.TermWidth()
 		ui.Body.Align()
 		ui.Clear()
-		ui.Render(ui.Body)
+		dash.render()
 	})
 }
 
-func newGasGraph() *ui.Sparklines {
-	spark := ui.Sparkline{}
+func newGasGraph() *graph {
+	spark := graphLine{}
 	spark.Height = 8
 	spark.Title = "Gas limit"
-	spark.LineColor = ui.ColorCyan
-	spark.TitleColor = ui.ColorWhite
+	spark.LineColor = th.gasLimit
+	spark.TitleColor = th.title
+	spark.MarkColor = th.accentColor
 
-	spark2 := ui.Sparkline{}
+	spark2 := graphLine{}
 	spark2.Height = 8
 	spark2.Title = "Gas used"
-	spark2.LineColor = ui.ColorRed
-	spark2.TitleColor = ui.ColorWhite
+	spark2.LineColor = th.gasUsed
+	spark2.TitleColor = th.title
+	spark2.ClampColor = th.color(levelBad)
+
+	// the percentage view shown with v, on a fixed scale
+	percent := graphLine{}
+	percent.Height = 16
+	percent.Title = "Gas used % (0-100)"
+	percent.LineColor = th.gasPercent
+	percent.TitleColor = th.title
+	percent.Max = 100
 
-	sp := ui.NewSparklines(spark, spark2)
+	sp := newGraph(spark, spark2)
+	sp.Alt = []graphLine{percent}
 	sp.Height = 20
 	sp.BorderLabel = "Gas statistics"
+	if minimal {
+		// keep the room of the lines and the label, not of the border
+		stripChrome(&sp.Block)
+		sp.Height--
+	}
 
 	return sp
 }
 
-func newBlockTimeGraph() *ui.Sparklines {
-	spark := ui.Sparkline{}
+// toggleGasPercentLine adds or removes the gas used percentage line of the
+// gas graph along with its long-term trend, shrinking the other lines to
+// make room for them. It's only called from run, which owns the lines.
+func toggleGasPercentLine(sp *graph) {
+	if len(sp.Lines) > 2 {
+		sp.Lines = sp.Lines[:2]
+		sp.Lines[0].Height, sp.Lines[1].Height = 8, 8
+		return
+	}
+	spark := graphLine{}
+	spark.Height = 3
+	spark.Title = "Gas used %"
+	spark.LineColor = th.gasPercent
+	spark.TitleColor = th.title
+
+	// the trend is pinned to 100% so that its slow drift isn't magnified
+	trend := graphLine{}
+	trend.Height = 3
+	trend.Title = "Gas used % (long-term)"
+	trend.LineColor = th.gasPercent
+	trend.TitleColor = th.title
+	trend.Max = 100
+
+	sp.Lines[0].Height, sp.Lines[1].Height = 4, 4
+	sp.Lines = append(sp.Lines, spark, trend)
+}
+
+// utilisationTrendTitle describes the long-term average of the gas used.
+func utilisationTrendTitle(avg, decay float64) string {
+	return fmt.Sprintf("Gas used %% (long-term): %s%% (decay %s/block)", formatFloat(avg), formatFloat(decay))
+}
+
+// blockTimeLabel returns the border label of the block time graph showing
+// the average block time of the window and, if enabled, the trimmed mean.
+func blockTimeLabel(blockTime []int, trim int, showTrimmed bool) string {
+	label := "Block time: avg " + formatBlockTime(mean(blockTime))
+	if trim > 0 && showTrimmed {
+		label += fmt.Sprintf(", trimmed(%d%%) %s", trim, formatBlockTime(trimmedMean(blockTime, trim)))
+	}
+	return label
+}
+
+func newBlockTimeGraph() *graph {
+	spark := graphLine{}
 	spark.Height = 5
-	spark.LineColor = ui.ColorMagenta
-	spark.TitleColor = ui.ColorWhite
+	spark.LineColor = th.blockTime
+	spark.TitleColor = th.title
+	spark.ClampColor = th.color(levelBad)
 
-	sp := ui.NewSparklines(spark)
+	sp := newGraph(spark)
 	sp.Height = 8
 	sp.BorderLabel = "Block time"
+	if minimal {
+		stripChrome(&sp.Block)
+		sp.Height--
+	}
+
+	return sp
+}
+
+// newCorrelationPar returns the readout of the correlation between gas used
+// and base fee. It's revealed once the first base fee was seen, so it stays
+// hidden on pre-London chains.
+func newCorrelationPar() *ui.Par {
+	par := ui.NewPar("waiting for blocks...")
+	par.Height = 4
+	par.BorderLabel = "Correlations"
+
+	return par
+}
+
+// correlationText describes the correlation coefficient of gas used and
+// base fee over n blocks. Since the base fee follows the gas used of the
+// previous blocks, a weak correlation hints at unusual fee behaviour.
+func correlationText(r float64, n int) string {
+	l := levelGood
+	switch {
+	case r < 0:
+		l = levelBad
+	case r < 0.3:
+		l = levelWarn
+	}
+	return fmt.Sprintf("r = %s over %d blocks", th.mark(l, formatFloat(r)), n)
+}
+
+// blockTimeCorrelationText describes the correlation coefficient of block
+// times and gas used, n/a if it's undefined as either is constant. A
+// positive correlation hints at full blocks slowing down block production.
+func blockTimeCorrelationText(r float64, ok bool) string {
+	if !ok {
+		return "corr blocktime/gas: n/a"
+	}
+	return fmt.Sprintf("corr blocktime/gas: %+.*f", precision, r)
+}
+
+// correlations holds the per block series of the correlation panel, which
+// is fed by both the block time and the fetch observer. It's only accessed
+// from run.
+type correlations struct {
+	gas, fee      []float64 // gas used of the parent and base fee
+	time, timeGas []float64 // block time and gas used
+	feeText       string    // last defined gas/base fee correlation
+}
+
+func newCorrelations() *correlations {
+	return &correlations{feeText: "gas/base fee: waiting for base fees..."}
+}
+
+// addBlockTime accounts the block time and gas used of a block.
+func (c *correlations) addBlockTime(blockTime, gasUsed float64) {
+	if len(c.time) == maxSamples {
+		c.time, c.timeGas = c.time[1:], c.timeGas[1:]
+	}
+	c.time, c.timeGas = append(c.time, blockTime), append(c.timeGas, gasUsed)
+}
+
+// addBaseFee accounts the base fee of a block along with the gas used of its
+// parent, which the base fee is derived from.
+func (c *correlations) addBaseFee(parentGasUsed, baseFee float64) {
+	if len(c.gas) == maxSamples {
+		c.gas, c.fee = c.gas[1:], c.fee[1:]
+	}
+	c.gas, c.fee = append(c.gas, parentGasUsed), append(c.fee, baseFee)
+	if r, ok := correlation(c.gas, c.fee); ok {
+		c.feeText = "gas/base fee: " + correlationText(r, len(c.gas))
+	}
+}
+
+// samples returns the number of blocks accounted in either correlation.
+func (c *correlations) samples() int {
+	return len(c.time) + len(c.gas)
+}
+
+// text renders both correlations for the correlation panel.
+func (c *correlations) text() string {
+	r, ok := correlation(c.time, c.timeGas)
+	return c.feeText + "\n" + blockTimeCorrelationText(r, ok)
+}
+
+func newBlockRatePar() *ui.Par {
+	par := ui.NewPar("waiting for blocks...")
+	par.Height = 3
+	par.BorderLabel = "Block rate"
+
+	return par
+}
+
+// newGasComparisonChart returns a two bar chart comparing the gas used by the
+// previous and the current block. The first data set holds the previous
+// block, the second the current one so that each can be coloured separately.
+func newGasComparisonChart() *ui.MBarChart {
+	bc := ui.NewMBarChart()
+	bc.Height = 9
+	bc.BorderLabel = "Gas used (prev/cur)"
+	bc.DataLabels = []string{"prev", "cur"}
+	bc.BarWidth = 12
+	bc.BarColor[0] = th.previous
+	bc.BarColor[1] = th.color(levelGood)
+	bc.NumColor[0] = ui.ColorWhite
+	bc.NumColor[1] = ui.ColorBlack
+
+	return bc
+}
+
+// updateGasComparison sets the previous and current gas used on the chart,
+// colouring the current bar as bad if demand went up and good otherwise. The
+// label of the current bar carries an arrow so the direction doesn't depend
+// on colour alone.
+func updateGasComparison(bc *ui.MBarChart, prev, cur *big.Int) {
+	bc.Data[0] = []int{sampleValue(prev, nil), 0}
+	bc.Data[1] = []int{0, sampleValue(cur, nil)}
+	if cur.Cmp(prev) > 0 {
+		bc.BarColor[1] = th.color(levelBad)
+		bc.DataLabels[1] = "cur ^"
+	} else {
+		bc.BarColor[1] = th.color(levelGood)
+		bc.DataLabels[1] = "cur v"
+	}
+}
+
+func newTxGasPar() *ui.Par {
+	par := ui.NewPar("enable with -fetch")
+	par.Height = 3
+	par.BorderLabel = "Tx gas limit vs used"
+
+	return par
+}
+
+// updateTxGasPar shows how much gas transactions request compared to what
+// they actually consume on average.
+func updateTxGasPar(par *ui.Par, block *rpcBlock) {
+	limit, used, ok := txGasEfficiency(block)
+	if !ok {
+		par.Text = "no transactions (empty block)"
+		return
+	}
+	par.Text = fmt.Sprintf("avg limit %s, avg used %s", formatFloat(limit), formatFloat(used))
+	if used > 0 {
+		par.Text += fmt.Sprintf(" (%sx)", formatFloat(limit/used))
+	}
+}
+
+func newProcGraph() *graph {
+	spark := graphLine{}
+	spark.Height = 3
+	spark.LineColor = th.accentColor
+	spark.TitleColor = th.title
+
+	sp := newGraph(spark)
+	sp.Height = 6
+	sp.BorderLabel = "Processing time (ms)"
 
 	return sp
 }
@@ -0,0 +1,36 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunCancelled(t *testing.T) {
+	// nothing listens on the port, run keeps retrying until cancelled
+	cfg := &config{
+		path:           "ws://127.0.0.1:1",
+		backoffInitial: time.Hour,
+		backoffMax:     time.Hour,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- run(ctx, cfg, newDashboard(), newSession(), nil, nil, nil, nil)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("run returned %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run didn't return within 1s of the cancellation")
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockTimeBuckets are the upper bounds in seconds of the block time
+// histogram buckets.
+var blockTimeBuckets = []float64{1, 2, 5, 10, 12, 15, 20, 30, 60, 120}
+
+// chainMetrics holds what the monitor exposes to Prometheus with the
+// -metrics-listen flag. It's written by run and read by the metrics handler.
+// All methods are no-ops on a nil chainMetrics.
+type chainMetrics struct {
+	mu sync.Mutex
+
+	height   uint64
+	gasUsed  uint64
+	gasLimit uint64
+	peers    int // -1 until the peer count was polled
+	blocks   uint64
+
+	blockTimeCounts []uint64 // observations per bucket of blockTimeBuckets, not cumulative
+	blockTimeSum    float64
+	blockTimeCount  uint64
+}
+
+func newChainMetrics() *chainMetrics {
+	return &chainMetrics{peers: -1, blockTimeCounts: make([]uint64, len(blockTimeBuckets))}
+}
+
+// onHeader accounts a processed head, which makes chainMetrics an observer.
+func (m *chainMetrics) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.height = header.Number.Uint64()
+	m.gasUsed = header.GasUsed.Uint64()
+	m.gasLimit = header.GasLimit.Uint64()
+	m.blocks++
+
+	if t, ok := state.metrics[metricBlockTime]; ok {
+		for i, bound := range blockTimeBuckets {
+			if t <= bound {
+				m.blockTimeCounts[i]++
+				break
+			}
+		}
+		m.blockTimeSum += t
+		m.blockTimeCount++
+	}
+}
+
+// setPeers records the polled peer count of the node.
+func (m *chainMetrics) setPeers(count int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.peers = count
+}
+
+// write renders the metrics in the Prometheus text exposition format.
+// Gauges of the chain are left out until the first head was processed.
+func (m *chainMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	if m.blocks > 0 {
+		gauge("moneth_block_height", "Number of the latest processed block.", m.height)
+		gauge("moneth_gas_used", "Gas used by the latest processed block.", m.gasUsed)
+		gauge("moneth_gas_limit", "Gas limit of the latest processed block.", m.gasLimit)
+	}
+	if m.peers >= 0 {
+		gauge("moneth_peers", "Number of peers of the node.", m.peers)
+	}
+	fmt.Fprintf(w, "# HELP moneth_blocks_total Blocks processed since the start.\n# TYPE moneth_blocks_total counter\nmoneth_blocks_total %d\n", m.blocks)
+
+	fmt.Fprintln(w, "# HELP moneth_block_time_seconds Time between the timestamps of consecutive blocks.")
+	fmt.Fprintln(w, "# TYPE moneth_block_time_seconds histogram")
+	var cumulative uint64
+	for i, bound := range blockTimeBuckets {
+		cumulative += m.blockTimeCounts[i]
+		fmt.Fprintf(w, "moneth_block_time_seconds_bucket{le=\"%v\"} %d\n", bound, cumulative)
+	}
+	fmt.Fprintf(w, "moneth_block_time_seconds_bucket{le=\"+Inf\"} %d\n", m.blockTimeCount)
+	fmt.Fprintf(w, "moneth_block_time_seconds_sum %v\n", m.blockTimeSum)
+	fmt.Fprintf(w, "moneth_block_time_seconds_count %d\n", m.blockTimeCount)
+}
+
+func (m *chainMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/metrics" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m.write(w)
+}
+
+// serveMetrics serves the metrics on the listener until it's closed.
+func serveMetrics(l net.Listener, m *chainMetrics, console *console) {
+	if err := http.Serve(l, m); err != nil {
+		console.writeln("Metrics endpoint stopped: ", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	ui "github.com/gizak/termui"
+)
+
+// nodeCollector follows one of the nodes given on the command line for the
+// nodes panel. It only polls what the panel compares between nodes, the
+// rest of the dashboard stays with the first endpoint. It's written by
+// collect and read by the UI goroutine.
+type nodeCollector struct {
+	endpoint string
+
+	mu      sync.Mutex
+	head    *types.Header
+	peers   int   // -1 if net_peerCount is unavailable
+	err     error // last failure, nil once the node answers again
+	updated time.Time
+}
+
+func newNodeCollector(endpoint string) *nodeCollector {
+	return &nodeCollector{endpoint: endpoint, peers: -1}
+}
+
+// collect polls the head and the peer count of the node until ctx is
+// cancelled, backing off while the node is unreachable.
+func (c *nodeCollector) collect(ctx context.Context, retry *backoff) {
+	var rpcClient *rpc.Client
+	for rpcClient == nil {
+		var err error
+		if rpcClient, err = dialEndpoint(ctx, c.endpoint); err != nil {
+			c.failed(err)
+			if retry.wait(ctx) != nil {
+				return
+			}
+		}
+	}
+	retry.reset()
+	client := ethclient.NewClient(rpcClient)
+
+	for {
+		header, err := client.HeaderByNumber(ctx, nil)
+		if err != nil {
+			c.failed(err)
+			if retry.wait(ctx) != nil {
+				return
+			}
+			continue
+		}
+		retry.reset()
+		peers, err := fetchPeerCount(ctx, rpcClient)
+		if err != nil {
+			peers = -1
+		}
+
+		c.mu.Lock()
+		c.head, c.peers, c.err, c.updated = header, peers, nil, time.Now()
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// failed records a failed request.
+func (c *nodeCollector) failed(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.err = err
+}
+
+// nodeRow formats the status of the node relative to the highest head of all
+// nodes, e.g. "ws://node2  head 1234567 (-2)  peers 25  gas 48%  3s ago".
+func nodeRow(endpoint string, head *types.Header, peers int, err error, updated time.Time, best uint64) string {
+	name := fmt.Sprintf("%-24s", shorten(redactEndpoint(endpoint), 24))
+	if head == nil {
+		if err != nil {
+			return name + " " + th.mark(levelBad, "unreachable: "+redactError(err, endpoint))
+		}
+		return name + " waiting for first head..."
+	}
+	number := head.Number.Uint64()
+	lag := th.mark(levelGood, "(tip)")
+	if behind := best - number; number < best {
+		l := levelWarn
+		if behind > 3 {
+			l = levelBad
+		}
+		lag = th.mark(l, fmt.Sprintf("(-%d)", behind))
+	}
+	peerText := "-"
+	if peers >= 0 {
+		peerText = fmt.Sprint(peers)
+	}
+	row := fmt.Sprintf("%s head %s %s  peers %s  gas %s%%", name, formatBlockUint(number), lag, peerText, formatFloat(utilisation(head)))
+	if !updated.IsZero() {
+		row += fmt.Sprintf("  %v ago", time.Since(updated).Round(time.Second))
+	}
+	if err != nil {
+		row += "  " + th.mark(levelBad, "failing: "+redactError(err, endpoint))
+	}
+	return row
+}
+
+// shorten cuts s to at most n characters, marking the cut with "~".
+func shorten(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-1] + "~"
+}
+
+func newNodesList() *ui.List {
+	list := ui.NewList()
+	list.Height = 3
+	list.BorderLabel = "Nodes"
+	list.Items = []string{"waiting for heads..."}
+
+	return list
+}
+
+// updateNodesList renders a row per node, comparing each head against the
+// highest head of all nodes.
+func updateNodesList(list *ui.List, nodes []*nodeCollector) {
+	type status struct {
+		head    *types.Header
+		peers   int
+		err     error
+		updated time.Time
+	}
+	all := make([]status, len(nodes))
+	var best uint64
+	for i, c := range nodes {
+		c.mu.Lock()
+		all[i] = status{c.head, c.peers, c.err, c.updated}
+		c.mu.Unlock()
+		if h := all[i].head; h != nil && h.Number.Uint64() > best {
+			best = h.Number.Uint64()
+		}
+	}
+	items := make([]string, len(nodes))
+	for i, s := range all {
+		items[i] = nodeRow(nodes[i].endpoint, s.head, s.peers, s.err, s.updated, best)
+	}
+	list.Items = items
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// blockState is what the monitor learned about a block. It's filled in as
+// the block passes the observers: the built-in observers for gas limit
+// alerts, block times and fetched blocks set their fields for the observers
+// registered after them.
+type blockState struct {
+	parent  *types.Header      // previously processed head, nil for the first
+	arrival time.Time          // local time processing of the block started
+	metrics map[string]float64 // rule metrics of the block
+	crossed bool               // whether the gas limit crossed a notable level
+	block   *rpcBlock          // nil unless the block was fetched
+	baseFee *big.Int           // nil unless fetched from a post-London chain
+}
+
+// observer is a feature fed with every processed head. Observers run on the
+// monitor goroutine in registration order.
+type observer interface {
+	onHeader(ctx context.Context, header *types.Header, state *blockState)
+}
+
+// observerFunc adapts a function to an observer.
+type observerFunc func(ctx context.Context, header *types.Header, state *blockState)
+
+func (f observerFunc) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	f(ctx, header, state)
+}
+
+// pipeline is the list of observers registered for a session.
+type pipeline []observer
+
+// register adds the observer to the end of the pipeline.
+func (p *pipeline) register(o observer) {
+	*p = append(*p, o)
+}
+
+// onHeader passes the head to every observer in order.
+func (p pipeline) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	for _, o := range p {
+		o.onHeader(ctx, header, state)
+	}
+}
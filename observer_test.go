@@ -0,0 +1,308 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// testHeader returns a synthetic header.
+func testHeader(number, timestamp, gasLimit, gasUsed int64) *types.Header {
+	return &types.Header{
+		Number:   big.NewInt(number),
+		Time:     big.NewInt(timestamp),
+		GasLimit: big.NewInt(gasLimit),
+		GasUsed:  big.NewInt(gasUsed),
+	}
+}
+
+// feed chains the headers up, passes them through the observer in order the
+// way run does and returns the state of each block.
+func feed(o observer, headers ...*types.Header) []*blockState {
+	var (
+		states []*blockState
+		parent *types.Header
+		start  = time.Now()
+	)
+	for i, h := range headers {
+		if parent != nil {
+			h.ParentHash = parent.Hash()
+		}
+		state := &blockState{
+			parent:  parent,
+			arrival: start.Add(time.Duration(i) * time.Second),
+			metrics: map[string]float64{
+				metricUtilisation: utilisation(h),
+				metricGasUsed:     float64(h.GasUsed.Uint64()),
+				metricGasLimit:    float64(h.GasLimit.Uint64()),
+			},
+		}
+		o.onHeader(context.Background(), h, state)
+		states = append(states, state)
+		parent = h
+	}
+	return states
+}
+
+// consoleHas reports whether a console message contains text.
+func consoleHas(c *console, text string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, m := range c.msgs {
+		if strings.Contains(m.text, text) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGasLimitObserver(t *testing.T) {
+	dash := newDashboard()
+	o := newGasLimitObserver([]uint64{31000000}, nil, dash.console)
+
+	states := feed(o,
+		testHeader(1, 12, 30000000, 0),
+		testHeader(2, 24, 30010000, 0), // within the bound
+		testHeader(3, 36, 31000000, 0), // beyond the bound, crossing the level
+	)
+	if states[0].crossed || states[1].crossed {
+		t.Errorf("level crossed before block 3")
+	}
+	if !states[2].crossed {
+		t.Errorf("level crossing at block 3 not flagged")
+	}
+	if !consoleHas(dash.console, "changed beyond the 1/1024 bound (30010000 -> 31000000)") {
+		t.Errorf("no alert about the gas limit change beyond the bound")
+	}
+	if !consoleHas(dash.console, "Gas limit moved above") {
+		t.Errorf("no message about the level crossing")
+	}
+}
+
+func TestGasLimitObserverLondon(t *testing.T) {
+	dash := newDashboard()
+	o := newGasLimitObserver(nil, big.NewInt(2), dash.console)
+
+	// the London block doubles the limit, the doubling is fine there only
+	feed(o,
+		testHeader(1, 12, 15000000, 0),
+		testHeader(2, 24, 30000000, 0),
+	)
+	if consoleHas(dash.console, "beyond the 1/1024 bound") {
+		t.Errorf("doubling at the London block reported")
+	}
+	feed(o,
+		testHeader(3, 36, 30000000, 0),
+		testHeader(4, 48, 60000000, 0),
+	)
+	if !consoleHas(dash.console, "gas limit of block 4 changed beyond the 1/1024 bound") {
+		t.Errorf("doubling after the London block not reported")
+	}
+}
+
+func TestGasLimitOutOfBounds(t *testing.T) {
+	tests := []struct {
+		parent, cur uint64
+		london      bool
+		want        bool
+	}{
+		{30000000, 30029000, false, false},
+		{30000000, 29971000, false, false},
+		{30000000, 30029297, false, true}, // the bound itself is out
+		{30000000, 60000000, false, true},
+		{15000000, 30000000, true, false},
+		{15000000, 30029000, true, false},
+		{15000000, 15000000, true, true},
+	}
+	for _, tt := range tests {
+		if got := gasLimitOutOfBounds(tt.parent, tt.cur, tt.london); got != tt.want {
+			t.Errorf("gasLimitOutOfBounds(%d, %d, %v) = %v, want %v", tt.parent, tt.cur, tt.london, got, tt.want)
+		}
+	}
+}
+
+func TestBlockTimeObserver(t *testing.T) {
+	dash := newDashboard()
+	sess := newSession()
+	o := newBlockTimeObserver(dash, sess, &config{sampleSize: 1}, newCorrelations())
+
+	states := feed(o,
+		testHeader(1, 100, 30000000, 1000000),
+		testHeader(2, 112, 30000000, 2000000),
+		testHeader(3, 127, 30000000, 3000000),
+	)
+	if _, ok := states[0].metrics[metricBlockTime]; ok {
+		t.Errorf("block time measured without a parent")
+	}
+	for i, want := range []float64{12, 15} {
+		if got := states[i+1].metrics[metricBlockTime]; got != want {
+			t.Errorf("block %d: block time %v, want %v", i+2, got, want)
+		}
+	}
+	if want := []int{12, 15}; !reflect.DeepEqual(o.series, want) {
+		t.Errorf("block time series %v, want %v", o.series, want)
+	}
+	if len(o.corr.time) != 2 {
+		t.Errorf("%d block times correlated, want 2", len(o.corr.time))
+	}
+}
+
+func TestBlockTimeObserverIdenticalTimestamps(t *testing.T) {
+	dash := newDashboard()
+	sess := newSession()
+	o := newBlockTimeObserver(dash, sess, &config{sampleSize: 1}, newCorrelations())
+
+	states := feed(o,
+		testHeader(1, 100, 30000000, 0),
+		testHeader(2, 100, 30000000, 0),
+		testHeader(3, 100, 30000000, 0),
+		testHeader(4, 112, 30000000, 0),
+	)
+	if _, ok := states[1].metrics[metricBlockTime]; ok {
+		t.Errorf("block time measured from identical timestamps")
+	}
+	// the arrival deltas of a second stand in for the block times
+	if want := []int{1, 1, 12}; !reflect.DeepEqual(o.series, want) {
+		t.Errorf("block time series %v, want %v", o.series, want)
+	}
+	if sess.blockTimes != 3 || sess.blockTimeMin != 1 {
+		t.Errorf("session accounted %d block times with minimum %d, want 3 with minimum 1", sess.blockTimes, sess.blockTimeMin)
+	}
+	if !consoleHas(dash.console, "identical block timestamps") {
+		t.Errorf("identical timestamps not reported")
+	}
+	if !consoleHas(dash.console, "3 blocks with identical timestamp") {
+		t.Errorf("no warning with the length of the run")
+	}
+}
+
+func TestGasObserver(t *testing.T) {
+	dash := newDashboard()
+	o := newGasObserver(dash, newSession(), &config{sampleSize: 2, scale: scaleRaw}, &ewma{alpha: 0.5})
+
+	feed(o,
+		testHeader(1, 12, 30000000, 12000000),
+		testHeader(2, 24, 30000000, 18000000),
+		testHeader(3, 36, 32000000, 16000000),
+	)
+	// two blocks per point, the third block is still in the bucket
+	if want := []int{150000}; !reflect.DeepEqual(o.used, want) {
+		t.Errorf("gas used series %v, want %v", o.used, want)
+	}
+	if want := []int{50}; !reflect.DeepEqual(o.percent, want) {
+		t.Errorf("gas used percentage series %v, want %v", o.percent, want)
+	}
+	if got := o.trend.value; got != 50 {
+		t.Errorf("long-term gas used %v%%, want 50%%", got)
+	}
+
+	// a level crossing marks the gas limit point of its bucket
+	state := &blockState{parent: testHeader(3, 36, 32000000, 16000000), metrics: map[string]float64{}, crossed: true}
+	o.onHeader(context.Background(), testHeader(4, 48, 36000000, 0), state)
+	if want := []int{0, 1}; !reflect.DeepEqual(o.limitMarks, want) {
+		t.Errorf("gas limit marks %v, want %v", o.limitMarks, want)
+	}
+	if want := []int{30, 34}; !reflect.DeepEqual(o.limit, want) {
+		t.Errorf("gas limit series %v, want %v", o.limit, want)
+	}
+}
+
+func TestFetchObserver(t *testing.T) {
+	dash := newDashboard()
+	o := newFetchObserver(dash, newSession(), nil, &config{}, newCorrelations())
+
+	baseFee := big.NewInt(2000000000) // 2 gwei
+	block := &rpcBlock{
+		Number:       (*hexutil.Big)(big.NewInt(1)),
+		GasUsed:      15000000,
+		GasLimit:     30000000,
+		BaseFee:      (*hexutil.Big)(baseFee),
+		Transactions: []*rpcTransaction{{Gas: 21000}, {Gas: 50000}},
+	}
+	state := &blockState{metrics: map[string]float64{}}
+	o.observe(&blockData{block: block}, big.NewInt(20000000), state)
+
+	if state.block != block {
+		t.Errorf("fetched block not set in the state")
+	}
+	if got := state.metrics[metricTxs]; got != 2 {
+		t.Errorf("tx count %v, want 2", got)
+	}
+	if want := []int{2}; !reflect.DeepEqual(o.txs, want) {
+		t.Errorf("tx series %v, want %v", o.txs, want)
+	}
+	if state.baseFee == nil || state.baseFee.Cmp(baseFee) != 0 {
+		t.Errorf("base fee %v, want %v", state.baseFee, baseFee)
+	}
+	if got := state.metrics[metricBaseFee]; got != 2 {
+		t.Errorf("base fee metric %v gwei, want 2", got)
+	}
+	if want := []int{2000}; !reflect.DeepEqual(o.baseFees, want) {
+		t.Errorf("base fee series %v mwei, want %v", o.baseFees, want)
+	}
+	// the base fee pairs with the gas used of the parent
+	if want := []float64{20000000}; !reflect.DeepEqual(o.corr.gas, want) {
+		t.Errorf("correlated gas used %v, want the parent's %v", o.corr.gas, want)
+	}
+
+	// without the parent there's nothing to pair
+	o.observe(&blockData{block: block}, nil, &blockState{metrics: map[string]float64{}})
+	if len(o.corr.gas) != 1 {
+		t.Errorf("%d base fees correlated, want 1", len(o.corr.gas))
+	}
+}
+
+func TestPipelineOrder(t *testing.T) {
+	var order []string
+	var p pipeline
+	for _, name := range []string{"first", "second", "third"} {
+		name := name
+		p.register(observerFunc(func(ctx context.Context, header *types.Header, state *blockState) {
+			order = append(order, name)
+		}))
+	}
+	p.onHeader(context.Background(), testHeader(1, 12, 30000000, 0), &blockState{})
+
+	if want := []string{"first", "second", "third"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("observers ran in order %v, want %v", order, want)
+	}
+}
+
+func TestLoopDetector(t *testing.T) {
+	d := newLoopDetector()
+
+	header := testHeader(1, 12, 30000000, 0)
+	if repeat, _, _, _ := d.observe(header); repeat {
+		t.Fatalf("first announcement reported as a repeat")
+	}
+	var loops int
+	for i := 0; i < loopThreshold; i++ {
+		repeat, loop, low, high := d.observe(header)
+		if !repeat {
+			t.Fatalf("announcement %d not reported as a repeat", i+2)
+		}
+		if loop {
+			loops++
+			if low != 1 || high != 1 {
+				t.Errorf("looping over blocks %d-%d, want 1-1", low, high)
+			}
+		}
+	}
+	if loops != 1 {
+		t.Errorf("loop reported %d times, want once", loops)
+	}
+	if got, want := d.announcements(header.Hash()), loopThreshold+1; got != want {
+		t.Errorf("%d announcements counted, want %d", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// gzipFile is a gzip compressed file. Closing it flushes the compressor and
+// writes the gzip trailer before closing the underlying file.
+type gzipFile struct {
+	*gzip.Writer
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	err := g.Writer.Close()
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// openOutput creates the output file at path. If compress is set the file
+// is gzip compressed and a ".gz" suffix is appended to its name.
+func openOutput(path string, compress bool) (io.WriteCloser, error) {
+	if compress && !strings.HasSuffix(path, ".gz") {
+		path += ".gz"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if !compress {
+		return f, nil
+	}
+	return &gzipFile{Writer: gzip.NewWriter(f), f: f}, nil
+}
+
+// exporter writes a CSV row for every block the monitor sees.
+type exporter struct {
+	w   io.WriteCloser
+	csv *csv.Writer
+}
+
+var csvColumns = []string{"number", "hash", "time", "gas_limit", "gas_used"}
+
+// newExporter creates the CSV file at path and writes the column names.
+func newExporter(path string, compress bool) (*exporter, error) {
+	w, err := openOutput(path, compress)
+	if err != nil {
+		return nil, err
+	}
+	e := &exporter{w: w, csv: csv.NewWriter(w)}
+	if err := e.csv.Write(csvColumns); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// writeHeader exports the header. Exports always use absolute block
+// numbers. It's a no-op on a nil exporter.
+func (e *exporter) writeHeader(header *types.Header) error {
+	if e == nil {
+		return nil
+	}
+	e.csv.Write([]string{
+		header.Number.String(),
+		header.Hash().Hex(),
+		header.Time.String(),
+		header.GasLimit.String(),
+		header.GasUsed.String(),
+	})
+	e.csv.Flush()
+
+	return e.csv.Error()
+}
+
+// Close flushes the remaining rows and closes the file.
+func (e *exporter) Close() error {
+	if e == nil {
+		return nil
+	}
+	e.csv.Flush()
+	if err := e.csv.Error(); err != nil {
+		e.w.Close()
+		return err
+	}
+	return e.w.Close()
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	ui "github.com/gizak/termui"
+)
+
+// peerInterval is the time between two requests for the peers of the node.
+// It's set with -peer-interval.
+var peerInterval = 15 * time.Second
+
+// maxPeerRows is the number of peers listed in the peer list.
+const maxPeerRows = 8
+
+// peerInfo is a peer as returned by admin_peers.
+type peerInfo struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"` // e.g. Geth/v1.13.5-stable/linux-amd64/go1.21.4
+	Network struct {
+		RemoteAddress string `json:"remoteAddress"`
+		Inbound       bool   `json:"inbound"`
+	} `json:"network"`
+}
+
+// fetchPeerCount requests the number of peers with net_peerCount.
+func fetchPeerCount(ctx context.Context, client *rpc.Client) (int, error) {
+	var count hexutil.Uint64
+	if err := client.CallContext(ctx, &count, "net_peerCount"); err != nil {
+		return 0, err
+	}
+	return int(count), nil
+}
+
+// fetchPeers requests the peers with admin_peers, which most nodes only
+// expose over IPC.
+func fetchPeers(ctx context.Context, client *rpc.Client) ([]peerInfo, error) {
+	var peers []peerInfo
+	if err := client.CallContext(ctx, &peers, "admin_peers"); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// clientVersion splits the client name of a peer into the client and its
+// version, e.g. "Geth" and "v1.13.5-stable". Custom name parts between
+// them are skipped.
+func clientVersion(name string) (client, version string) {
+	parts := strings.Split(name, "/")
+	client, version = parts[0], "-"
+	for _, p := range parts[1:] {
+		if len(p) > 1 && p[0] == 'v' && p[1] >= '0' && p[1] <= '9' {
+			version = p
+			break
+		}
+	}
+	if client == "" {
+		client = "unknown"
+	}
+	return client, version
+}
+
+// peerChurn counts the peers that joined and left since the previous list.
+// It's only accessed from run.
+type peerChurn struct {
+	known map[string]bool // IDs of the previous list, nil before the first
+}
+
+// observe returns the number of peers joined and left since the last call.
+func (c *peerChurn) observe(peers []peerInfo) (joined, left int) {
+	ids := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		ids[p.ID] = true
+		if c.known != nil && !c.known[p.ID] {
+			joined++
+		}
+	}
+	for id := range c.known {
+		if !ids[id] {
+			left++
+		}
+	}
+	c.known = ids
+	return joined, left
+}
+
+func newPeerCountGraph() *ui.Sparklines {
+	spark := ui.Sparkline{}
+	spark.Height = 3
+	spark.Title = "waiting for net_peerCount..."
+	spark.LineColor = th.accentColor
+	spark.TitleColor = th.title
+
+	sp := ui.NewSparklines(spark)
+	sp.Height = 6
+	sp.BorderLabel = "Peers"
+
+	return sp
+}
+
+func newPeerList() *ui.List {
+	list := ui.NewList()
+	list.Height = maxPeerRows + 2
+	list.BorderLabel = "Peer clients"
+	list.Items = []string{"waiting for admin_peers..."}
+
+	return list
+}
+
+// updatePeerList lists the peers by client and version, inbound peers
+// marked with "in". Latencies aren't exposed over RPC.
+func updatePeerList(list *ui.List, peers []peerInfo, joined, left int) {
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+
+	items := make([]string, 0, maxPeerRows)
+	for i, p := range peers {
+		if i == maxPeerRows-1 && len(peers) > maxPeerRows {
+			items = append(items, fmt.Sprintf("... %d more", len(peers)-i))
+			break
+		}
+		client, version := clientVersion(p.Name)
+		dir := "out"
+		if p.Network.Inbound {
+			dir = "in"
+		}
+		items = append(items, fmt.Sprintf("%-12s %-22s %-3s %s", client, version, dir, p.Network.RemoteAddress))
+	}
+	if len(items) == 0 {
+		items = []string{"no peers"}
+	}
+	list.Items = items
+	list.BorderLabel = fmt.Sprintf("Peer clients (+%d -%d since last poll)", joined, left)
+}
+
+// peerMonitor polls the peers of the node into the peers and peer list
+// panels. It's only accessed from run.
+type peerMonitor struct {
+	client  *rpc.Client
+	counts  []int
+	churn   peerChurn
+	noAdmin bool // set once admin_peers failed
+	polled  bool // whether the panels were revealed
+}
+
+func newPeerMonitor(client *rpc.Client) *peerMonitor {
+	return &peerMonitor{client: client}
+}
+
+// poll updates the panels with the current peers and returns the peer
+// count. The peer list is given up once admin_peers fails, an error is only
+// returned if the peer count isn't available either.
+func (m *peerMonitor) poll(ctx context.Context, dash *dashboard, sess *session) (int, error) {
+	count, err := fetchPeerCount(ctx, m.client)
+	if err != nil {
+		return 0, err
+	}
+	m.counts = pushSample(m.counts, count)
+	dash.peers.Lines[0].Data = m.counts
+	dash.peers.Lines[0].Title = fmt.Sprintf("%d peers", count)
+	sess.record("Peers", m.counts)
+	dash.touch(dash.peers)
+
+	if !m.noAdmin {
+		peers, err := fetchPeers(ctx, m.client)
+		if err != nil {
+			m.noAdmin = true
+			dash.console.writeln("Peers: admin_peers unavailable, not listing peer clients: ", err)
+		} else {
+			joined, left := m.churn.observe(peers)
+			updatePeerList(dash.peerList, peers, joined, left)
+			dash.touch(dash.peerList)
+		}
+	}
+	if !m.polled {
+		m.polled = true
+		dash.reveal("peers")
+		if !m.noAdmin {
+			dash.reveal("peerlist")
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// pollInterval is the time between two polls for the latest header. It's
+// set with -poll-interval.
+var pollInterval = 4 * time.Second
+
+// tipInterval is the time between two requests for the tip of the node,
+// which tells how far the displayed head is behind. It's set with
+// -tip-interval.
+var tipInterval = 15 * time.Second
+
+// trackTip periodically records the latest block number of the node in the
+// session until ctx is cancelled. Heads received from the subscription
+// update the tip as well, the requests cover heads that were dropped or
+// never delivered.
+func trackTip(ctx context.Context, client *ethclient.Client, sess *session) {
+	ticker := time.NewTicker(tipInterval)
+	defer ticker.Stop()
+
+	for {
+		if header, err := client.HeaderByNumber(ctx, nil); err == nil {
+			sess.observeTip(header.Number.Uint64())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollHeads polls the node for its latest header and delivers every new
+// head to dst. Failed polls are retried after the backoff rather than the
+// poll interval. It returns when ctx is cancelled or when stop reports true,
+// e.g. because the subscription started delivering heads.
+func pollHeads(ctx context.Context, client *ethclient.Client, dst chan<- *types.Header, stop func() bool, retry *backoff, console *console) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var last *types.Header
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if stop() {
+			console.writeln("OK: Subscription delivers heads, stopped polling")
+			return
+		}
+		header, err := client.HeaderByNumber(ctx, nil)
+		for err != nil {
+			console.alert(levelWarn, fmt.Sprint("polling latest header failed: ", err))
+			if retry.wait(ctx) != nil {
+				return
+			}
+			header, err = client.HeaderByNumber(ctx, nil)
+		}
+		retry.reset()
+		if last != nil && header.Hash() == last.Hash() {
+			continue
+		}
+		last = header
+
+		select {
+		case dst <- header:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
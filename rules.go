@@ -0,0 +1,233 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Metrics rules can be defined on. Metrics that aren't available for a block,
+// e.g. the base fee without -fetch, leave the rules on them unevaluated.
+const (
+	metricUtilisation = "utilisation" // gas used in percent of the gas limit
+	metricGasUsed     = "gasUsed"
+	metricGasLimit    = "gasLimit"
+	metricBlockTime   = "blockTime" // seconds since the parent block
+	metricBaseFee     = "baseFee"   // gwei, requires -fetch
+	metricTxs         = "txs"       // number of transactions, requires -fetch
+)
+
+var ruleMetrics = []string{metricUtilisation, metricGasUsed, metricGasLimit, metricBlockTime, metricBaseFee, metricTxs}
+
+// rule is a predicate flagging interesting blocks. Rules are loaded from a
+// JSON file holding a list of rules, each being one of
+//
+//	{"name": "full blocks", "metric": "utilisation", "op": ">", "value": 95, "for": 3}
+//	{"name": "fee doubled", "metric": "baseFee", "rise": 100, "within": 5}
+//	{"name": "exchange", "to": "0xabc..."}
+//
+// i.e. a comparison holding for a number of consecutive blocks, a rise of
+// the metric in percent within a number of blocks, or a transaction sent to
+// an address.
+type rule struct {
+	Name   string  `json:"name"`
+	Metric string  `json:"metric"`
+	Op     string  `json:"op"`
+	Value  float64 `json:"value"`
+	For    int     `json:"for"`
+	Rise   float64 `json:"rise"`
+	Within int     `json:"within"`
+	To     string  `json:"to"`
+
+	to      common.Address
+	streak  int       // consecutive blocks the comparison held for
+	history []float64 // the metric of the last Within blocks
+}
+
+// compare applies the comparison operator of the rule to v.
+func (r *rule) compare(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Value
+	case ">=":
+		return v >= r.Value
+	case "<":
+		return v < r.Value
+	case "<=":
+		return v <= r.Value
+	case "==":
+		return v == r.Value
+	default:
+		return v != r.Value
+	}
+}
+
+// check validates the rule and fills in the defaults.
+func (r *rule) check() error {
+	if r.To != "" {
+		if !common.IsHexAddress(r.To) {
+			return fmt.Errorf("invalid address %q", r.To)
+		}
+		r.to = common.HexToAddress(r.To)
+		return nil
+	}
+	known := false
+	for _, m := range ruleMetrics {
+		known = known || m == r.Metric
+	}
+	if !known {
+		return fmt.Errorf("unknown metric %q (known: %s)", r.Metric, strings.Join(ruleMetrics, ","))
+	}
+	if r.Rise > 0 {
+		if r.Within < 1 {
+			r.Within = 1
+		}
+		return nil
+	}
+	switch r.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Errorf("invalid operator %q", r.Op)
+	}
+	if r.For < 1 {
+		r.For = 1
+	}
+	return nil
+}
+
+// loadRules reads the rules from the JSON file at path.
+func loadRules(path string) ([]*rule, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*rule
+	if err := json.Unmarshal(blob, &rules); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %v", path, err)
+	}
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.check(); err != nil {
+			return nil, fmt.Errorf("invalid rules file %s: %s: %v", path, r.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+// evaluate runs the rules against the metrics of a block and returns a
+// description of every match. block is nil unless it was fetched.
+func evaluate(rules []*rule, metrics map[string]float64, block *rpcBlock) []string {
+	var matches []string
+	for _, r := range rules {
+		if r.To != "" {
+			if block == nil {
+				continue
+			}
+			for _, tx := range block.Transactions {
+				if tx.To != nil && *tx.To == r.to {
+					matches = append(matches, fmt.Sprintf("%s: tx %s to %s", r.Name, shortHex(tx.Hash.Hex()), shortHex(r.to.Hex())))
+				}
+			}
+			continue
+		}
+		v, ok := metrics[r.Metric]
+		if !ok {
+			continue
+		}
+		if r.Rise > 0 {
+			if low := minFloat(r.history); len(r.history) > 0 && low > 0 && (v-low)/low*100 >= r.Rise {
+				matches = append(matches, fmt.Sprintf("%s: %s rose %s -> %s within %d blocks", r.Name, r.Metric, formatFloat(low), formatFloat(v), r.Within))
+				r.history = nil // report each rise once
+			}
+			if len(r.history) == r.Within {
+				r.history = r.history[1:]
+			}
+			r.history = append(r.history, v)
+			continue
+		}
+		if !r.compare(v) {
+			r.streak = 0
+			continue
+		}
+		if r.streak++; r.streak == r.For {
+			matches = append(matches, fmt.Sprintf("%s: %s %s %s for %d blocks", r.Name, r.Metric, r.Op, formatFloat(r.Value), r.For))
+		}
+	}
+	return matches
+}
+
+func minFloat(xs []float64) float64 {
+	var min float64
+	for i, x := range xs {
+		if i == 0 || x < min {
+			min = x
+		}
+	}
+	return min
+}
+
+// ruleMatch is the JSON body posted to the rule webhook.
+type ruleMatch struct {
+	Block uint64 `json:"block"`
+	Hash  string `json:"hash"`
+	Match string `json:"match"`
+}
+
+// postMatch pushes a rule match to the webhook.
+func postMatch(url string, match ruleMatch) error {
+	blob, err := json.Marshal(match)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ruleObserver evaluates the rules against every block, recording matches
+// as anomalies and posting them to the webhook, if any.
+type ruleObserver struct {
+	rules     []*rule
+	webhook   string
+	anomalies *anomalyLog
+	console   *console
+}
+
+func newRuleObserver(rules []*rule, webhook string, anomalies *anomalyLog, console *console) *ruleObserver {
+	return &ruleObserver{rules: rules, webhook: webhook, anomalies: anomalies, console: console}
+}
+
+func (o *ruleObserver) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	for _, match := range evaluate(o.rules, state.metrics, state.block) {
+		o.anomalies.record(anomalyRule, header.Number.Uint64(), match)
+		if o.webhook == "" {
+			continue
+		}
+		go func(m ruleMatch) {
+			if err := postMatch(o.webhook, m); err != nil {
+				o.console.alert(levelWarn, fmt.Sprint("failed to post rule match: ", err))
+			}
+		}(ruleMatch{Block: header.Number.Uint64(), Hash: header.Hash().Hex(), Match: match})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// sampler aggregates consecutive blocks into buckets of either a fixed
+// number of blocks or a fixed span of block time, so that very fast chains
+// produce a single graph point per bucket rather than one per block. Gas
+// values are averaged over the bucket, as are the block times that were
+// measured within it, while transactions are summed up.
+type sampler struct {
+	size int           // number of blocks per bucket, unless span is set
+	span time.Duration // block time per bucket, 0 for buckets of size blocks
+
+	blocks      int    // number of blocks in the current bucket
+	first       uint64 // timestamp of the first block in the current bucket
+	gasLimit    int
+	gasUsed     int
+	utilisation int
+	blockTime   int
+	blockTimes  int // number of block time samples in the current bucket
+	txs         int
+}
+
+// point is a single aggregated graph point.
+type point struct {
+	gasLimit    int  // in millions of gas
+	gasUsed     int  // in units of 100 gas
+	utilisation int  // gas used as a percentage of the gas limit
+	blockTime   int  // in the block time unit
+	hasTime     bool // whether a block time was measured in the bucket
+	txs         int  // transactions of all blocks in the bucket
+}
+
+// newSampler returns a sampler that aggregates size blocks per bucket, or
+// the blocks of span seconds of block time if span is set. A size of one or
+// less without a span disables aggregation.
+func newSampler(size int, span time.Duration) *sampler {
+	if size < 1 {
+		size = 1
+	}
+	return &sampler{size: size, span: span}
+}
+
+// parseSample parses the -sample setting, either a number of blocks such as
+// "10" or a span of block time such as "30s".
+func parseSample(s string) (size int, span time.Duration, err error) {
+	if size, err := strconv.Atoi(s); err == nil {
+		if size < 1 {
+			return 0, 0, fmt.Errorf("invalid sample size %d: must be at least 1", size)
+		}
+		return size, 0, nil
+	}
+	span, err = time.ParseDuration(s)
+	if err != nil || span < time.Second {
+		return 0, 0, fmt.Errorf("invalid sample %q: must be a number of blocks or a duration of at least 1s", s)
+	}
+	return 1, span, nil
+}
+
+// add adds the block's gas values to the current bucket and reports whether
+// the bucket is full.
+func (s *sampler) add(timestamp uint64, gasLimit, gasUsed, utilisation int) bool {
+	s.gasLimit += gasLimit
+	s.gasUsed += gasUsed
+	s.utilisation += utilisation
+
+	return s.addBlock(timestamp)
+}
+
+// addBlock counts a block without gas values, for samplers only averaging
+// block times, and reports whether the bucket is full. A time bucket is
+// full with the first block span after the first block of the bucket.
+func (s *sampler) addBlock(timestamp uint64) bool {
+	if s.blocks == 0 {
+		s.first = timestamp
+	}
+	s.blocks++
+	if s.span > 0 {
+		return timestamp > s.first && time.Duration(timestamp-s.first)*time.Second >= s.span
+	}
+	return s.blocks >= s.size
+}
+
+// addTxs adds the transaction count of a block to the current bucket. It's
+// called before the block is counted with addBlock.
+func (s *sampler) addTxs(n int) {
+	s.txs += n
+}
+
+// addBlockTime adds a block time measurement to the current bucket.
+func (s *sampler) addBlockTime(t int) {
+	s.blockTime += t
+	s.blockTimes++
+}
+
+// flush returns the averages of the current bucket and resets it.
+func (s *sampler) flush() point {
+	var p point
+	if s.blocks > 0 {
+		p.gasLimit = s.gasLimit / s.blocks
+		p.gasUsed = s.gasUsed / s.blocks
+		p.utilisation = s.utilisation / s.blocks
+	}
+	if s.blockTimes > 0 {
+		p.blockTime, p.hasTime = s.blockTime/s.blockTimes, true
+	}
+	p.txs = s.txs
+	*s = sampler{size: s.size, span: s.span}
+
+	return p
+}
+
+// pushSample appends v to the series, evicting the oldest samples if the
+// series already holds the number of points of the graph window.
+func pushSample(series []int, v int) []int {
+	if n := int(atomic.LoadInt32(&graphWindow)); len(series) >= n {
+		series = series[len(series)-n+1:]
+	}
+	return append(series, v)
+}
+
+// graphWindow is the number of points kept for each graph. It's changed by
+// the window command while the monitor is running.
+var graphWindow int32 = maxSamples
+
+// setGraphWindow changes the number of points kept for each graph.
+func setGraphWindow(n int) {
+	atomic.StoreInt32(&graphWindow, int32(n))
+}
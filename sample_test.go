@@ -0,0 +1,81 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseSample(t *testing.T) {
+	tests := []struct {
+		in   string
+		size int
+		span time.Duration
+		fail bool
+	}{
+		{in: "1", size: 1},
+		{in: "10", size: 10},
+		{in: "30s", size: 1, span: 30 * time.Second},
+		{in: "2m", size: 1, span: 2 * time.Minute},
+		{in: "0", fail: true},
+		{in: "-3", fail: true},
+		{in: "500ms", fail: true},
+		{in: "blocks", fail: true},
+	}
+	for _, tt := range tests {
+		size, span, err := parseSample(tt.in)
+		if (err != nil) != tt.fail {
+			t.Errorf("parseSample(%q) error %v, want failure %v", tt.in, err, tt.fail)
+			continue
+		}
+		if size != tt.size || span != tt.span {
+			t.Errorf("parseSample(%q) = %d, %v, want %d, %v", tt.in, size, span, tt.size, tt.span)
+		}
+	}
+}
+
+func TestSamplerTimeBuckets(t *testing.T) {
+	s := newSampler(1, 30*time.Second)
+
+	// blocks every 10 seconds, the fourth one closes the bucket
+	var points []point
+	for i, txs := range []int{3, 5, 2, 4, 7} {
+		s.addTxs(txs)
+		if s.add(uint64(100+10*i), 30, 100, 50) {
+			points = append(points, s.flush())
+		}
+	}
+	want := []point{{gasLimit: 30, gasUsed: 100, utilisation: 50, txs: 14}}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("points %+v, want %+v", points, want)
+	}
+	// the next bucket starts with the following block
+	if s.blocks != 1 || s.first != 140 || s.txs != 7 || s.span != 30*time.Second {
+		t.Errorf("sampler after flush %+v, want a bucket holding the fifth block", s)
+	}
+
+	// identical timestamps never close a time bucket
+	s = newSampler(1, time.Second)
+	for i := 0; i < 3; i++ {
+		if s.addBlock(100) {
+			t.Errorf("bucket closed on block %d with an identical timestamp", i)
+		}
+	}
+}
+
+func TestSamplerBlockBuckets(t *testing.T) {
+	s := newSampler(2, 0)
+
+	s.addTxs(3)
+	if s.add(100, 30, 100, 40) {
+		t.Fatalf("bucket closed after one of two blocks")
+	}
+	s.addTxs(4)
+	if !s.add(100, 30, 200, 60) {
+		t.Fatalf("bucket still open after two blocks")
+	}
+	want := point{gasLimit: 30, gasUsed: 150, utilisation: 50, txs: 7}
+	if got := s.flush(); got != want {
+		t.Errorf("point %+v, want %+v", got, want)
+	}
+}
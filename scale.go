@@ -0,0 +1,103 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Gas used scaling modes, selected with the -scale flag.
+const (
+	// scaleRaw plots gas used in units of 100 gas.
+	scaleRaw = "raw"
+	// scaleRollingMax plots gas used as a percentage of the largest value
+	// within the window, making small variations on quiet chains visible.
+	scaleRollingMax = "rollingmax"
+	// scaleAbsolute plots gas used in gas, labelled with its magnitude.
+	scaleAbsolute = "absolute"
+)
+
+var scaleModes = []string{scaleRaw, scaleRollingMax, scaleAbsolute}
+
+// gasUnit is the amount of gas of a raw gas used sample.
+const gasUnit = 100
+
+// validScale returns an error if mode isn't a known scaling mode.
+func validScale(mode string) error {
+	for _, m := range scaleModes {
+		if m == mode {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown scale %q (known: %v)", mode, scaleModes)
+}
+
+// maxSample is the largest value of a graph sample. Samples are summed when
+// averaging buckets and windows, so they're kept well within the int range.
+const maxSample = math.MaxInt32
+
+// sampleValue converts v, in units of unit, into a graph sample. The value
+// is clamped to 0..maxSample rather than wrapped around, so that values such
+// as difficulties or bogus header fields beyond the int64 range don't turn
+// into negative or garbage bars. unit may be nil to convert v as is.
+func sampleValue(v, unit *big.Int) int {
+	if unit != nil {
+		v = new(big.Int).Div(v, unit)
+	}
+	switch {
+	case v.Sign() < 0:
+		return 0
+	case !v.IsInt64() || v.Int64() > maxSample:
+		return maxSample
+	}
+	return int(v.Int64())
+}
+
+// windowMax returns the largest value of the series.
+func windowMax(series []int) int {
+	max := 0
+	for _, v := range series {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// windowMin returns the smallest value of the series, or 0 if it's empty.
+func windowMin(series []int) int {
+	min := 0
+	for i, v := range series {
+		if i == 0 || v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// scaleSeries returns the display series of the raw samples for the given
+// mode. The raw samples are never modified.
+func scaleSeries(mode string, raw []int) []int {
+	scaled := make([]int, len(raw))
+	if mode == scaleAbsolute {
+		for i, v := range raw {
+			scaled[i] = v * gasUnit
+		}
+		return scaled
+	}
+	if mode != scaleRollingMax {
+		return raw
+	}
+	max := windowMax(raw)
+	if max == 0 {
+		return scaled
+	}
+	for i, v := range raw {
+		scaled[i] = v * 100 / max
+	}
+	return scaled
+}
@@ -0,0 +1,51 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestSampleValue(t *testing.T) {
+	maxInt64 := big.NewInt(math.MaxInt64)
+	beyond := new(big.Int).Add(maxInt64, big.NewInt(1))
+	huge := new(big.Int).Lsh(big.NewInt(1), 200)
+
+	tests := []struct {
+		name string
+		v    *big.Int
+		unit *big.Int
+		want int
+	}{
+		{"zero", big.NewInt(0), nil, 0},
+		{"small", big.NewInt(21000), nil, 21000},
+		{"negative", big.NewInt(-5), nil, 0},
+		{"max sample", big.NewInt(maxSample), nil, maxSample},
+		{"above max sample", big.NewInt(maxSample + 1), nil, maxSample},
+		{"int64 max", maxInt64, nil, maxSample},
+		{"int64 max plus one", beyond, nil, maxSample},
+		{"beyond int64", huge, nil, maxSample},
+		{"negative beyond int64", new(big.Int).Neg(huge), nil, 0},
+		{"unit", big.NewInt(30000000), big.NewInt(gasUnit), 300000},
+		{"unit truncates", big.NewInt(199), big.NewInt(gasUnit), 1},
+		{"unit brings int64 max in range", maxInt64, big.NewInt(1 << 40), int(math.MaxInt64 >> 40)},
+		{"unit keeps beyond int64 clamped", huge, big.NewInt(1 << 40), maxSample},
+	}
+	for _, tt := range tests {
+		if got := sampleValue(tt.v, tt.unit); got != tt.want {
+			t.Errorf("%s: sampleValue(%v, %v) = %d, want %d", tt.name, tt.v, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestSampleValueKeepsInput(t *testing.T) {
+	v := big.NewInt(30000000)
+	sampleValue(v, big.NewInt(gasUnit))
+	if v.Int64() != 30000000 {
+		t.Errorf("sampleValue modified its input to %v", v)
+	}
+}
@@ -0,0 +1,561 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// session keeps track of the totals of a monitoring session. It's shared
+// between the monitor and main, which writes out a report on exit.
+type session struct {
+	mu sync.Mutex
+
+	start       time.Time
+	latest      *types.Header
+	latestBlock *rpcBlock       // most recently fetched full block
+	recent      []*types.Header // the last historyLimit headers, oldest first
+
+	lastArrival time.Time     // local time the last live head arrived
+	avgInterval time.Duration // moving average of the time between heads
+	procTime    time.Duration // moving average of the local processing time
+	drift       time.Duration // median delay of heads behind their timestamp
+	driftLevel  level
+
+	tip     uint64                 // highest block number the node is known to have
+	syncing *ethereum.SyncProgress // nil unless the node is syncing
+
+	blocks  int
+	dropped int // headers dropped due to backpressure
+	repeats int // heads re-announcing a recent block
+	reorgs  int // heads not building on the previous head
+
+	endpoint string   // endpointID of the node, if identified
+	chainID  *big.Int // chain ID of the node, if identified
+
+	window []*blockEvent // the blocks of the graph window, oldest first
+
+	blockTimes   int   // number of block time measurements
+	blockTimeSum int64 // sum of all block times in the block time unit
+	blockTimeMin int
+	blockTimeMax int
+
+	utilisations   int
+	utilisationSum float64 // sum of gas used percentages
+
+	burned       *big.Int // wei burned by the base fee
+	burnedBlocks int      // number of blocks accounted in burned
+	reconnects   int
+	disconnects  int
+	downSince    time.Time // when the subscription dropped, zero while connected
+
+	alerts     []firedAlert // the last maxReportAlerts alerts, oldest first
+	alertCount int          // number of alerts fired in total
+
+	series      map[string][]int // copies of the graph series for the web mirror
+	seriesOrder []string
+
+	highs, lows map[string]*extreme // highest and lowest value of every rule metric
+}
+
+func newSession() *session {
+	return &session{start: time.Now(), burned: new(big.Int), series: make(map[string][]int)}
+}
+
+// addHeader accounts a newly seen header.
+func (s *session) addHeader(header *types.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blocks++
+	if s.latest != nil && header.ParentHash != s.latest.Hash() && header.Number.Cmp(new(big.Int).Add(s.latest.Number, common.Big1)) <= 0 {
+		s.reorgs++
+	}
+	s.latest = header
+	s.recent = s.recent[evictions(len(s.recent)):]
+	s.recent = append(s.recent, header)
+	if header.GasLimit.Sign() > 0 {
+		s.utilisationSum += utilisation(header)
+		s.utilisations++
+	}
+}
+
+// setSync records the sync progress of the node, nil if it isn't syncing.
+func (s *session) setSync(progress *ethereum.SyncProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.syncing = progress
+}
+
+// syncProgress returns the sync progress of the node, nil if it isn't
+// syncing.
+func (s *session) syncProgress() *ethereum.SyncProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.syncing
+}
+
+// observeTip records a block number the node is known to have reached.
+func (s *session) observeTip(number uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if number > s.tip {
+		s.tip = number
+	}
+}
+
+// behind returns the number of blocks between the displayed head and the
+// tip of the node, e.g. while a gap is filled or queued heads are worked
+// off.
+func (s *session) behind() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latest == nil || !s.latest.Number.IsUint64() || s.latest.Number.Uint64() >= s.tip {
+		return 0
+	}
+	return s.tip - s.latest.Number.Uint64()
+}
+
+// setEndpoint records the chain ID and the endpointID of the node.
+func (s *session) setEndpoint(chainID *big.Int, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chainID, s.endpoint = chainID, id
+}
+
+// addEvent records the event of a processed block in the graph window.
+func (s *session) addEvent(event *blockEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if n := int(atomic.LoadInt32(&graphWindow)); len(s.window) >= n {
+		s.window = s.window[len(s.window)-n+1:]
+	}
+	s.window = append(s.window, event)
+}
+
+// exportWindows writes the blocks of the graph window along with their block
+// times as a JSON document to a timestamped file and returns its name.
+func (s *session) exportWindows() (string, error) {
+	type row struct {
+		*blockEvent
+		BlockTime *uint64 `json:"blockTime,omitempty"` // seconds since the previous block
+	}
+	s.mu.Lock()
+	doc := struct {
+		ChainID    string    `json:"chainId,omitempty"`
+		ExportTime time.Time `json:"exportTime"`
+		WindowSize int       `json:"windowSize"`
+		Blocks     []row     `json:"blocks"`
+	}{ExportTime: time.Now(), WindowSize: int(atomic.LoadInt32(&graphWindow)), Blocks: make([]row, len(s.window))}
+	if s.chainID != nil {
+		doc.ChainID = s.chainID.String()
+	}
+	for i, event := range s.window {
+		doc.Blocks[i].blockEvent = event
+		if i > 0 && event.ParentHash == s.window[i-1].Hash && event.Time >= s.window[i-1].Time {
+			delta := event.Time - s.window[i-1].Time
+			doc.Blocks[i].BlockTime = &delta
+		}
+	}
+	s.mu.Unlock()
+
+	blob, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("moneth-windows-%s.json", doc.ExportTime.Format("20060102-150405"))
+	return name, ioutil.WriteFile(name, blob, 0644)
+}
+
+// endpointTotals returns the endpointID of the node along with the totals
+// of the session kept in the state file.
+func (s *session) endpointTotals() (id string, blocks, reorgs int, head uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latest != nil {
+		head = s.latest.Number.Uint64()
+	}
+	return s.endpoint, s.blocks, s.reorgs, head
+}
+
+// head returns the most recently seen header, or nil if none was seen yet.
+func (s *session) head() *types.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.latest
+}
+
+// chain returns the chain ID of the node, or nil if it wasn't identified.
+func (s *session) chain() *big.Int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.chainID
+}
+
+// record stores a copy of the named graph series.
+func (s *session) record(name string, data []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.series[name]; !ok {
+		s.seriesOrder = append(s.seriesOrder, name)
+	}
+	s.series[name] = append([]int(nil), data...)
+}
+
+// namedSeries is a graph series as recorded in the session.
+type namedSeries struct {
+	name string
+	data []int
+}
+
+// allSeries returns the recorded series in the order they were first seen.
+func (s *session) allSeries() []namedSeries {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	series := make([]namedSeries, len(s.seriesOrder))
+	for i, name := range s.seriesOrder {
+		series[i] = namedSeries{name: name, data: s.series[name]}
+	}
+	return series
+}
+
+// header returns the recently seen header of the given block number, or nil
+// if it's no longer remembered.
+func (s *session) header(number uint64) *types.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.recent) - 1; i >= 0; i-- {
+		if s.recent[i].Number.Uint64() == number {
+			return s.recent[i]
+		}
+	}
+	return nil
+}
+
+// dump writes the recorded graph series as a JSON object to a timestamped
+// file and returns its name.
+func (s *session) dump() (string, error) {
+	series := make(map[string][]int)
+	for _, ns := range s.allSeries() {
+		series[ns.name] = ns.data
+	}
+	state := struct {
+		Time   time.Time        `json:"time"`
+		Head   *blockEvent      `json:"head,omitempty"`
+		Series map[string][]int `json:"series"`
+	}{Time: time.Now(), Series: series}
+
+	if head := s.head(); head != nil {
+		state.Head = newBlockEvent(head, s.block(head))
+	}
+	blob, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("moneth-%s.json", state.Time.Format("20060102-150405"))
+	return name, ioutil.WriteFile(name, blob, 0644)
+}
+
+// setBlock stores the most recently fetched full block.
+func (s *session) setBlock(block *rpcBlock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latestBlock = block
+}
+
+// block returns the full block of the header if it was fetched.
+func (s *session) block(header *types.Header) *rpcBlock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latestBlock == nil || s.latestBlock.Hash != header.Hash() {
+		return nil
+	}
+	return s.latestBlock
+}
+
+// arrived records the arrival of a live head at time t.
+func (s *session) arrived(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lastArrival.IsZero() {
+		interval := t.Sub(s.lastArrival)
+		if s.avgInterval == 0 {
+			s.avgInterval = interval
+		} else {
+			s.avgInterval = (4*s.avgInterval + interval) / 5
+		}
+	}
+	s.lastArrival = t
+}
+
+// processed records the time spent processing a header locally.
+func (s *session) processed(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.procTime == 0 {
+		s.procTime = d
+	} else {
+		s.procTime = (4*s.procTime + d) / 5
+	}
+}
+
+// setDrift records the clock drift between the node and the local clock.
+func (s *session) setDrift(d time.Duration, l level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.drift, s.driftLevel = d, l
+}
+
+// clockDrift returns the clock drift and its level.
+func (s *session) clockDrift() (time.Duration, level) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.drift, s.driftLevel
+}
+
+// processingTime returns the moving average of the local processing time.
+func (s *session) processingTime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.procTime
+}
+
+// arrivals returns the arrival time of the last live head and the average
+// interval between heads.
+func (s *session) arrivals() (last time.Time, avg time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastArrival, s.avgInterval
+}
+
+// addBurn accounts the fees burned by a block with the given base fee.
+func (s *session) addBurn(baseFee *big.Int, gasUsed uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.burned.Add(s.burned, burnedFee(baseFee, gasUsed))
+	s.burnedBlocks++
+}
+
+// disconnected records that the subscription dropped.
+func (s *session) disconnected(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.downSince.IsZero() {
+		s.disconnects++
+	}
+	s.downSince = t
+}
+
+// maxReportAlerts is the number of alerts listed in the session report.
+const maxReportAlerts = 20
+
+// firedAlert is an alert as listed in the session report.
+type firedAlert struct {
+	time time.Time
+	lvl  level
+	msg  string
+}
+
+// addAlert records a fired alert for the report.
+func (s *session) addAlert(l level, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alertCount++
+	if len(s.alerts) == maxReportAlerts {
+		s.alerts = s.alerts[1:]
+	}
+	s.alerts = append(s.alerts, firedAlert{time: time.Now(), lvl: l, msg: msg})
+}
+
+// reconnected accounts a re-established subscription.
+func (s *session) reconnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reconnects++
+	s.downSince = time.Time{}
+}
+
+// connection returns when the subscription dropped, or the zero time if
+// it's connected.
+func (s *session) connection() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.downSince
+}
+
+// dropHead accounts a header dropped because the monitor fell behind.
+func (s *session) dropHead() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dropped++
+}
+
+// repeatHead accounts a head re-announcing a recent block, which isn't
+// processed again.
+func (s *session) repeatHead() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.repeats++
+}
+
+// droppedHeads returns the number of headers dropped so far.
+func (s *session) droppedHeads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// addBlockTime accounts a block time measurement in the block time unit.
+func (s *session) addBlockTime(t int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.blockTimes == 0 || t < s.blockTimeMin {
+		s.blockTimeMin = t
+	}
+	if t > s.blockTimeMax {
+		s.blockTimeMax = t
+	}
+	s.blockTimeSum += int64(t)
+	s.blockTimes++
+}
+
+// avgBlockTime returns the average block time of the session, or the
+// expected block time until one was measured.
+func (s *session) avgBlockTime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.blockTimes == 0 {
+		return expectedBlockTime()
+	}
+	unit := time.Second / time.Duration(blockTimeScales[blockTimeUnit])
+	return time.Duration(s.blockTimeSum/int64(s.blockTimes)) * unit
+}
+
+// summary formats a compact one line summary of the current state of the
+// chain, e.g. for pasting into a chat. The base fee and the throughput are
+// only known for fetched blocks.
+func (s *session) summary() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latest == nil {
+		return "no blocks received yet"
+	}
+	parts := []string{
+		"block " + s.latest.Number.String(),
+		formatFloat(utilisation(s.latest)) + "% gas",
+	}
+	var avg float64
+	if s.blockTimes > 0 {
+		avg = float64(s.blockTimeSum) / float64(s.blockTimes)
+		parts = append(parts, "avg block time "+formatBlockTime(avg))
+	}
+	if block := s.latestBlock; block != nil && block.Hash == s.latest.Hash() {
+		if block.BaseFee != nil {
+			parts = append(parts, "base fee "+formatGwei(block.BaseFee.ToInt())+" gwei")
+		}
+		if seconds := avg / float64(blockTimeScales[blockTimeUnit]); seconds > 0 {
+			parts = append(parts, formatFloat(float64(len(block.Transactions))/seconds)+" TPS")
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// report writes a table summarising the totals of the session to w.
+func (s *session) report(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var (
+		blockTime = "n/a"
+		gasUsed   = "n/a"
+		burned    = "n/a (requires -fetch on a post-London chain)"
+	)
+	if s.blockTimes > 0 {
+		avg := float64(s.blockTimeSum) / float64(s.blockTimes)
+		blockTime = fmt.Sprintf("%s / %d%s / %d%s", formatBlockTime(avg), s.blockTimeMin, blockTimeUnit, s.blockTimeMax, blockTimeUnit)
+	}
+	if s.utilisations > 0 {
+		gasUsed = formatFloat(s.utilisationSum/float64(s.utilisations)) + "%"
+	}
+	if s.burnedBlocks > 0 {
+		burned = fmt.Sprintf("%s ETH over %d blocks", formatEther(s.burned), s.burnedBlocks)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "Session summary\t")
+	fmt.Fprintln(tw, "---------------\t")
+	fmt.Fprintf(tw, "duration\t%v\n", time.Since(s.start).Round(time.Second))
+	fmt.Fprintf(tw, "blocks observed\t%d\n", s.blocks)
+	fmt.Fprintf(tw, "block time avg/min/max\t%s\n", blockTime)
+	fmt.Fprintf(tw, "avg gas used\t%s\n", gasUsed)
+	fmt.Fprintf(tw, "fees burned\t%s\n", burned)
+	fmt.Fprintf(tw, "reorgs\t%d\n", s.reorgs)
+	fmt.Fprintf(tw, "disconnects\t%d\n", s.disconnects)
+	fmt.Fprintf(tw, "reconnects\t%d\n", s.reconnects)
+	fmt.Fprintf(tw, "dropped heads\t%d\n", s.dropped)
+	fmt.Fprintf(tw, "repeated heads\t%d\n", s.repeats)
+	fmt.Fprintf(tw, "alerts fired\t%d\n", s.alertCount)
+	tw.Flush()
+
+	if len(s.alerts) == 0 {
+		return
+	}
+	if len(s.alerts) < s.alertCount {
+		fmt.Fprintf(w, "\nLast %d alerts:\n", len(s.alerts))
+	} else {
+		fmt.Fprintln(w, "\nAlerts:")
+	}
+	for _, a := range s.alerts {
+		severity := "WARN"
+		if a.lvl == levelBad {
+			severity = "ERROR"
+		}
+		fmt.Fprintf(w, "  %s %-5s %s\n", a.time.Format("15:04:05"), severity, a.msg)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSessionReport(t *testing.T) {
+	sess := newSession()
+	dash := newDashboard()
+	dash.console.sess = sess
+
+	// one outage with a failed retry counts as one disconnect
+	sess.disconnected(time.Now())
+	sess.disconnected(time.Now())
+	sess.reconnected()
+	sess.disconnected(time.Now())
+
+	dash.console.alert(levelWarn, "gas limit changed beyond the bound")
+	dash.console.alert(levelBad, "subscription dropped")
+
+	var buf bytes.Buffer
+	sess.report(&buf)
+	// the columns are padded, compare the words only
+	report := strings.Join(strings.Fields(buf.String()), " ")
+	for _, want := range []string{"disconnects 2", "reconnects 1", "alerts fired 2", "WARN gas limit changed beyond the bound", "ERROR subscription dropped"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report lacks %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestSessionReportAlertLimit(t *testing.T) {
+	sess := newSession()
+	for i := 0; i < maxReportAlerts+5; i++ {
+		sess.addAlert(levelWarn, fmt.Sprint("alert ", i))
+	}
+	var buf bytes.Buffer
+	sess.report(&buf)
+	report := buf.String()
+	if !strings.Contains(report, fmt.Sprintf("Last %d alerts", maxReportAlerts)) {
+		t.Errorf("report doesn't tell only the last alerts are listed:\n%s", report)
+	}
+	if strings.Contains(report, "alert 4\n") || !strings.Contains(report, "alert 5\n") {
+		t.Errorf("report doesn't list the last %d alerts:\n%s", maxReportAlerts, report)
+	}
+}
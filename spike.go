@@ -0,0 +1,186 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// spikeContext is the number of blocks recorded before and after a fee spike.
+const spikeContext = 3
+
+// feeSample is the fee level of a single block along with the metrics
+// recorded as the context of a spike.
+type feeSample struct {
+	number      uint64
+	fee         *big.Int // base fee, or the suggested gas price of pre-London nodes
+	utilisation float64
+}
+
+// feeSpike is a sharp rise of the fee level between two blocks, together
+// with the blocks surrounding it.
+type feeSpike struct {
+	from, to feeSample
+	seen     time.Time
+	before   []feeSample // blocks up to and including from
+	between  []feeSample // blocks after from up to and including to
+	after    []feeSample // blocks following to
+}
+
+func (s *feeSpike) String() string {
+	return fmt.Sprintf("fee spike: %s -> %s gwei over %d blocks", formatGwei(s.from.fee), formatGwei(s.to.fee), s.to.number-s.from.number)
+}
+
+// write appends the spike and its context to w, one block per line.
+func (s *feeSpike) write(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%s (%s)\n", s, s.seen.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	samples := append(append(append([]feeSample{}, s.before...), s.between...), s.after...)
+	for _, sample := range samples {
+		mark := " "
+		if sample.number == s.from.number || sample.number == s.to.number {
+			mark = "*"
+		}
+		if _, err := fmt.Fprintf(w, "%s #%d  %s gwei  %s%% gas used\n", mark, sample.number, formatGwei(sample.fee), formatFloat(sample.utilisation)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// spikeDetector reports fee levels rising by more than pct percent within
+// window blocks. After a report the detector stays quiet for window blocks
+// so that a single spike isn't reported for every block of its climb.
+type spikeDetector struct {
+	pct    float64
+	window int
+
+	history []feeSample // the last window+spikeContext blocks, oldest first
+	pending []*feeSpike // spikes waiting for their after context
+	quiet   uint64      // no spikes are reported before this block
+}
+
+func newSpikeDetector(pct float64, window int) *spikeDetector {
+	return &spikeDetector{pct: pct, window: window}
+}
+
+// observe adds the fee level of the next block. spike is set if the block
+// completes a spike; done holds the spikes whose after context is complete.
+func (d *spikeDetector) observe(sample feeSample) (spike *feeSpike, done []*feeSpike) {
+	// complete the context of earlier spikes
+	pending := d.pending[:0]
+	for _, s := range d.pending {
+		s.after = append(s.after, sample)
+		if len(s.after) == spikeContext {
+			done = append(done, s)
+		} else {
+			pending = append(pending, s)
+		}
+	}
+	d.pending = pending
+
+	if len(d.history) == d.window+spikeContext {
+		d.history = d.history[1:]
+	}
+	d.history = append(d.history, sample)
+
+	// compare against the lowest fee level within the window
+	start := len(d.history) - 1 - d.window
+	if start < 0 {
+		start = 0
+	}
+	low := start
+	for i := start; i < len(d.history)-1; i++ {
+		if d.history[i].fee.Cmp(d.history[low].fee) < 0 {
+			low = i
+		}
+	}
+	from := d.history[low]
+	if from.fee.Sign() == 0 || sample.number <= from.number || sample.number < d.quiet {
+		return nil, done
+	}
+	rise, _ := new(big.Rat).SetFrac(new(big.Int).Sub(sample.fee, from.fee), from.fee).Float64()
+	if rise*100 < d.pct {
+		return nil, done
+	}
+	d.quiet = sample.number + uint64(d.window)
+
+	before := low - spikeContext + 1
+	if before < 0 {
+		before = 0
+	}
+	spike = &feeSpike{
+		from:    from,
+		to:      sample,
+		seen:    time.Now(),
+		before:  append([]feeSample{}, d.history[before:low+1]...),
+		between: append([]feeSample{}, d.history[low+1:]...),
+	}
+	d.pending = append(d.pending, spike)
+
+	return spike, done
+}
+
+// appendSpike appends the spike snapshot to the file at path.
+func appendSpike(path string, spike *feeSpike) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := spike.write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// spikeObserver feeds the fee level of every block to the spike detector.
+// Without the base fee of a fetched block, the node's suggested gas price
+// stands in for the fee level if a client is set, at an RPC per block.
+type spikeObserver struct {
+	detector  *spikeDetector
+	client    *ethclient.Client // nil unless -fee-spike-gasprice is set
+	log       string            // file completed spikes are appended to, if any
+	anomalies *anomalyLog
+	console   *console
+}
+
+func newSpikeObserver(detector *spikeDetector, client *ethclient.Client, log string, anomalies *anomalyLog, console *console) *spikeObserver {
+	return &spikeObserver{detector: detector, client: client, log: log, anomalies: anomalies, console: console}
+}
+
+func (o *spikeObserver) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	fee := state.baseFee
+	if fee == nil && o.client != nil {
+		if price, err := o.client.SuggestGasPrice(ctx); err == nil {
+			fee = price
+		}
+	}
+	if fee == nil {
+		return
+	}
+	spike, done := o.detector.observe(feeSample{number: header.Number.Uint64(), fee: fee, utilisation: utilisation(header)})
+	if spike != nil {
+		o.anomalies.record(anomalySpike, spike.to.number, spike.String())
+	}
+	if o.log == "" {
+		return
+	}
+	for _, s := range done {
+		if err := appendSpike(o.log, s); err != nil {
+			o.console.alert(levelWarn, fmt.Sprint("failed to write fee spike: ", err))
+		}
+	}
+}
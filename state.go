@@ -0,0 +1,101 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"time"
+)
+
+// endpointStats are the totals of all sessions against a single endpoint,
+// kept in the state file across sessions.
+type endpointStats struct {
+	Endpoint  string    `json:"endpoint"`
+	Sessions  int       `json:"sessions"`
+	Blocks    int       `json:"blocks"`
+	Reorgs    int       `json:"reorgs"`
+	LastBlock uint64    `json:"lastBlock"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// endpointID identifies an endpoint across sessions by the chain ID and a
+// hash of its URL, so that neither the URL nor any credentials in it are
+// stored in plain text.
+func endpointID(chainID *big.Int, url string) string {
+	hash := sha256.Sum256([]byte(url))
+	return fmt.Sprintf("%s-%x", chainID, hash[:8])
+}
+
+// loadState reads the state file, a JSON object of endpointStats keyed by
+// endpointID. A missing file is an empty state.
+func loadState(path string) (map[string]*endpointStats, error) {
+	state := make(map[string]*endpointStats)
+
+	blob, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(blob, &state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %v", path, err)
+	}
+	return state, nil
+}
+
+// saveState writes the state file, replacing it only once the new content
+// is complete.
+func saveState(path string, state map[string]*endpointStats) error {
+	blob, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// persistSession adds the totals of the session to the stats of its
+// endpoint in the state file. Sessions that never identified their
+// endpoint are skipped.
+func persistSession(path string, sess *session) error {
+	id, blocks, reorgs, head := sess.endpointTotals()
+	if id == "" {
+		return nil
+	}
+	state, err := loadState(path)
+	if err != nil {
+		return err
+	}
+	stats := state[id]
+	if stats == nil {
+		stats = &endpointStats{Endpoint: id}
+		state[id] = stats
+	}
+	stats.Sessions++
+	stats.Blocks += blocks
+	stats.Reorgs += reorgs
+	if head > stats.LastBlock {
+		stats.LastBlock = head
+	}
+	stats.LastSeen = time.Now()
+
+	return saveState(path, state)
+}
+
+// describeEndpoint summarises the stats of an endpoint seen before, e.g.
+// "observed 14203 blocks across 6 sessions".
+func describeEndpoint(stats *endpointStats) string {
+	return fmt.Sprintf("observed %d blocks across %d sessions, last at block %d on %s (%d reorgs)",
+		stats.Blocks, stats.Sessions, stats.LastBlock, stats.LastSeen.Format("2006-01-02 15:04"), stats.Reorgs)
+}
@@ -0,0 +1,84 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	ui "github.com/gizak/termui"
+)
+
+// stateRoots counts the blocks that left the state root of their parent
+// unchanged. Almost every block changes the state, if only by paying the
+// coinbase, so an unchanged root means a truly empty block or an odd chain.
+type stateRoots struct {
+	compared  int // blocks compared against their parent
+	unchanged int // blocks with the state root of their parent
+	streak    int // consecutive unchanged blocks up to the last one
+}
+
+// observe compares the state root of the block with its parent's. Blocks
+// not building on the previous head aren't compared.
+func (r *stateRoots) observe(parent, header *types.Header) (unchanged, ok bool) {
+	if parent == nil || header.ParentHash != parent.Hash() {
+		return false, false
+	}
+	r.compared++
+	if header.Root != parent.Root {
+		r.streak = 0
+		return false, true
+	}
+	r.unchanged++
+	r.streak++
+	return true, true
+}
+
+// text describes the last comparison and the unchanged total, e.g.
+// "● changed | 2 of 1400 blocks unchanged".
+func (r *stateRoots) text(header *types.Header) string {
+	last := th.mark(levelGood, "● changed")
+	switch {
+	case r.streak > 1:
+		last = th.mark(levelBad, fmt.Sprintf("● unchanged at %s (%d in a row)", formatBlockNumber(header.Number), r.streak))
+	case r.streak == 1:
+		last = th.mark(levelWarn, "● unchanged at "+formatBlockNumber(header.Number))
+	}
+	return fmt.Sprintf("%s | %d of %d blocks unchanged", last, r.unchanged, r.compared)
+}
+
+func newStateRootPar() *ui.Par {
+	par := ui.NewPar("waiting for consecutive blocks...")
+	par.Height = 3
+	par.BorderLabel = "State root"
+
+	return par
+}
+
+// stateRootObserver feeds the state root panel.
+type stateRootObserver struct {
+	roots stateRoots
+	dash  *dashboard
+}
+
+func newStateRootObserver(dash *dashboard) *stateRootObserver {
+	return &stateRootObserver{dash: dash}
+}
+
+func (o *stateRootObserver) onHeader(ctx context.Context, header *types.Header, state *blockState) {
+	unchanged, ok := o.roots.observe(state.parent, header)
+	if !ok {
+		return
+	}
+	if o.roots.compared == 1 {
+		o.dash.reveal("stateroot")
+	}
+	if unchanged {
+		o.dash.console.logf(msgInfo, "State root unchanged by block %s (gas used %s)", formatBlockNumber(header.Number), formatHuman(header.GasUsed.Uint64()))
+	}
+	o.dash.stateRoot.Text = o.roots.text(header)
+	o.dash.touch(o.dash.stateRoot)
+}
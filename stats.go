@@ -0,0 +1,114 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"math"
+	"sort"
+)
+
+// mean returns the arithmetic mean of xs, or 0 if xs is empty.
+func mean(xs []int) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, x := range xs {
+		sum += x
+	}
+	return float64(sum) / float64(len(xs))
+}
+
+// trimmedMean returns the mean of xs after discarding the lowest and the
+// highest pct percent of the values. xs isn't modified.
+func trimmedMean(xs []int, pct int) float64 {
+	sorted := append([]int(nil), xs...)
+	sort.Ints(sorted)
+
+	k := len(sorted) * pct / 100
+	if 2*k >= len(sorted) {
+		return mean(sorted)
+	}
+	return mean(sorted[k : len(sorted)-k])
+}
+
+// median returns the median of xs, or 0 if xs is empty. xs isn't modified.
+func median(xs []int) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := append([]int(nil), xs...)
+	sort.Ints(sorted)
+
+	if n := len(sorted); n%2 == 0 {
+		return float64(sorted[n/2-1]+sorted[n/2]) / 2
+	}
+	return float64(sorted[len(sorted)/2])
+}
+
+// medianFloat returns the median of xs, or 0 if xs is empty. xs isn't
+// modified.
+func medianFloat(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), xs...)
+	sort.Float64s(sorted)
+
+	if n := len(sorted); n%2 == 0 {
+		return (sorted[n/2-1] + sorted[n/2]) / 2
+	}
+	return sorted[len(sorted)/2]
+}
+
+// correlation returns the Pearson correlation coefficient of the paired
+// samples xs and ys. The deviations from the means are summed in a second
+// pass rather than using the single pass formula, which loses precision
+// badly for large values such as gas. ok is false for fewer than three
+// pairs or if either series is constant.
+func correlation(xs, ys []float64) (r float64, ok bool) {
+	n := len(xs)
+	if len(ys) < n {
+		n = len(ys)
+	}
+	if n < 3 {
+		return 0, false
+	}
+	var mx, my float64
+	for i := 0; i < n; i++ {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx, my = mx/float64(n), my/float64(n)
+
+	var sxy, sxx, syy float64
+	for i := 0; i < n; i++ {
+		dx, dy := xs[i]-mx, ys[i]-my
+		sxy += dx * dy
+		sxx += dx * dx
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 {
+		return 0, false
+	}
+	return sxy / math.Sqrt(sxx*syy), true
+}
+
+// ewma is an exponentially weighted moving average. Every new value is
+// weighted with alpha, so that older values decay by 1-alpha per value.
+type ewma struct {
+	alpha  float64
+	value  float64
+	seeded bool // whether a value was added
+}
+
+// add accounts the next value; the first value seeds the average.
+func (e *ewma) add(v float64) {
+	if !e.seeded {
+		e.value, e.seeded = v, true
+		return
+	}
+	e.value += e.alpha * (v - e.value)
+}
@@ -0,0 +1,100 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	ui "github.com/gizak/termui"
+)
+
+// statusBar is a single line ui.Par at the bottom of the dashboard showing
+// the health of the subscription. It's only accessed from the UI goroutine.
+type statusBar struct {
+	*ui.Par
+
+	lastPulse time.Time // arrival time of the head the pulse last blinked for
+}
+
+func newStatusBar() *statusBar {
+	par := ui.NewPar("waiting for first head...")
+	par.Height = 3
+	par.BorderLabel = "Status"
+
+	return &statusBar{Par: par}
+}
+
+// healthLevel returns the level of the health dot based on the time since
+// the last head relative to the average interval between heads, or to the
+// expected block time of the chain until an average is known.
+func healthLevel(since, avg time.Duration) level {
+	if avg == 0 {
+		avg = expectedBlockTime()
+	}
+	switch {
+	case since < avg*3/2:
+		return levelGood
+	case since < avg*3:
+		return levelWarn
+	default:
+		return levelBad
+	}
+}
+
+// update redraws the status bar from the arrival times in the session. The
+// pulse blinks once for every head received since the previous update.
+func (s *statusBar) update(sess *session) {
+	last, avg := sess.arrivals()
+	if down := sess.connection(); !down.IsZero() {
+		s.Text = th.mark(levelBad, fmt.Sprintf("● disconnected for %v, retrying with backoff", time.Since(down).Round(time.Second)))
+		return
+	}
+	if last.IsZero() {
+		return
+	}
+	pulse := " "
+	if last != s.lastPulse {
+		pulse = "*"
+		s.lastPulse = last
+	}
+	since := time.Since(last)
+	head := "-"
+	if h := sess.head(); h != nil {
+		head = formatBlockNumber(h.Number) + catchUpReadout(sess.behind())
+	}
+	drift, driftLvl := sess.clockDrift()
+	s.Text = fmt.Sprintf("[%s](%s) %s head %s %v ago (avg interval %v) | drift %s | proc %s | mem %sB",
+		pulse, th.accent, th.mark(healthLevel(since, avg), "●"), head, since.Round(time.Second), avg.Round(time.Second),
+		th.mark(driftLvl, fmt.Sprintf("%+.1fs", drift.Seconds())), procReadout(sess.processingTime(), sess.avgBlockTime()), formatHuman(memoryFootprint()))
+}
+
+// catchUpReadout flags a displayed head that isn't the tip of the node, so
+// that historical data isn't mistaken for live data.
+func catchUpReadout(behind uint64) string {
+	if behind == 0 {
+		return " (live)"
+	}
+	return " " + th.mark(levelWarn, fmt.Sprintf("(catching up: %d blocks behind)", behind))
+}
+
+// procReadout formats the local processing time per block and whether the
+// dashboard keeps up with the average block time. It's flagged once the
+// processing takes up half of the block time, and once it falls behind, the
+// expensive opt-in features are named as the first thing to turn off.
+func procReadout(proc, blockTime time.Duration) string {
+	text := proc.Round(time.Millisecond).String()
+	switch {
+	case blockTime == 0 || proc == 0:
+		return text
+	case proc < blockTime/2:
+		return th.mark(levelGood, text+", keeping up")
+	case proc < blockTime:
+		return th.mark(levelWarn, text+", keeping up")
+	default:
+		behind := (proc - blockTime).Round(time.Millisecond)
+		return th.mark(levelBad, fmt.Sprintf("%s, falling behind by %v/block, try without -receipts/-fetch", text, behind))
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/ethclient"
+	ui "github.com/gizak/termui"
+)
+
+// syncInterval is the time between two requests for the sync progress. It's
+// set with -sync-interval.
+var syncInterval = 5 * time.Second
+
+// syncDemoted are the panels hidden while the node syncs, since graphs of
+// the blocks being imported say little about the chain.
+var syncDemoted = []string{"gas", "blocktime"}
+
+// trackSync periodically records the sync progress of the node in the
+// session until ctx is cancelled. The highest block of a syncing node is
+// the tip the displayed head is measured against.
+func trackSync(ctx context.Context, client *ethclient.Client, sess *session) {
+	ticker := time.NewTicker(syncInterval)
+	defer ticker.Stop()
+
+	for {
+		if progress, err := client.SyncProgress(ctx); err == nil {
+			sess.setSync(progress)
+			if progress != nil {
+				sess.observeTip(progress.HighestBlock)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncPanel is a gauge of the sync progress with an estimate of the time
+// left. It's only accessed from the UI goroutine.
+type syncPanel struct {
+	*ui.Gauge
+
+	since     time.Time // when the sync was first seen
+	fromBlock uint64    // current block when the sync was first seen
+	demoted   []string  // panels hidden for the sync, shown again after it
+}
+
+func newSyncPanel() *syncPanel {
+	gauge := ui.NewGauge()
+	gauge.Height = 3
+	gauge.BorderLabel = "Sync progress"
+	gauge.PercentColor = th.title
+	gauge.BarColor = th.accentColor
+
+	return &syncPanel{Gauge: gauge}
+}
+
+// update renders the progress, e.g. "block 1200 of 18000, states 3.2M of
+// 10.1M, ETA 1h12m". The ETA is extrapolated from the block rate since the
+// sync was first seen.
+func (p *syncPanel) update(progress *ethereum.SyncProgress) {
+	if p.since.IsZero() || progress.CurrentBlock < p.fromBlock {
+		// a restarted sync is measured afresh
+		p.since, p.fromBlock = time.Now(), progress.CurrentBlock
+	}
+	if span := sub(progress.HighestBlock, progress.StartingBlock); span > 0 {
+		p.Percent = int(sub(progress.CurrentBlock, progress.StartingBlock) * 100 / span)
+		if p.Percent > 100 {
+			p.Percent = 100
+		}
+	}
+	label := fmt.Sprintf("{{percent}}%%: block %d of %d", progress.CurrentBlock, progress.HighestBlock)
+	if progress.KnownStates > 0 {
+		label += fmt.Sprintf(", states %s of %s", formatHuman(progress.PulledStates), formatHuman(progress.KnownStates))
+	}
+	label += ", ETA " + syncETA(progress.CurrentBlock-p.fromBlock, sub(progress.HighestBlock, progress.CurrentBlock), time.Since(p.since))
+	p.Label = label
+}
+
+// sub returns a-b, or 0 rather than wrapping around if b is larger. Nodes
+// report the highest block lagging the current one at times.
+func sub(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
+
+// syncETA extrapolates the time left from the blocks imported in elapsed.
+func syncETA(done, left uint64, elapsed time.Duration) string {
+	if done == 0 || elapsed <= 0 {
+		return "unknown"
+	}
+	eta := time.Duration(float64(elapsed) * float64(left) / float64(done))
+	return eta.Round(time.Second).String()
+}
+
+// emphasizeSync shows the sync panel in place of the syncDemoted panels
+// while the node syncs and restores them once it's done. It reports
+// whether the layout changed. It must be called from the UI goroutine.
+func (d *dashboard) emphasizeSync(progress *ethereum.SyncProgress) bool {
+	p := d.sync
+	switch {
+	case progress != nil && p.since.IsZero():
+		for _, name := range syncDemoted {
+			for _, panel := range d.panels {
+				if panel.name == name && panel.enabled {
+					panel.enabled = false
+					p.demoted = append(p.demoted, name)
+				}
+			}
+		}
+		d.show("sync")
+		p.update(progress)
+		d.console.writef("Node is syncing, showing the sync progress in place of %v", p.demoted)
+		return true
+	case progress != nil:
+		p.update(progress)
+		d.touch(p)
+		return false
+	case !p.since.IsZero():
+		for _, name := range p.demoted {
+			d.show(name)
+		}
+		for _, panel := range d.panels {
+			if panel.name == "sync" {
+				panel.enabled = false
+			}
+		}
+		p.since, p.demoted = time.Time{}, nil
+		d.console.writeln("OK: Node finished syncing")
+		return true
+	}
+	return false
+}
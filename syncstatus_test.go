@@ -0,0 +1,58 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+)
+
+func TestSyncPanelUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress ethereum.SyncProgress
+		percent  int
+	}{
+		{"halfway", ethereum.SyncProgress{StartingBlock: 100, CurrentBlock: 150, HighestBlock: 200}, 50},
+		{"current beyond highest", ethereum.SyncProgress{StartingBlock: 100, CurrentBlock: 250, HighestBlock: 200}, 100},
+		{"current before starting", ethereum.SyncProgress{StartingBlock: 100, CurrentBlock: 50, HighestBlock: 200}, 0},
+		{"highest before starting", ethereum.SyncProgress{StartingBlock: 300, CurrentBlock: 250, HighestBlock: 200}, 0},
+	}
+	for _, tt := range tests {
+		p := newSyncPanel()
+		p.update(&tt.progress)
+		if p.Percent != tt.percent {
+			t.Errorf("%s: %d%%, want %d%%", tt.name, p.Percent, tt.percent)
+		}
+		if !strings.Contains(p.Label, "ETA unknown") {
+			t.Errorf("%s: label %q, want an unknown ETA", tt.name, p.Label)
+		}
+	}
+}
+
+func TestSyncPanelRestart(t *testing.T) {
+	p := newSyncPanel()
+	p.update(&ethereum.SyncProgress{CurrentBlock: 500, HighestBlock: 1000})
+
+	// the current block going backwards restarts the measurement
+	p.update(&ethereum.SyncProgress{CurrentBlock: 400, HighestBlock: 1000})
+	if p.fromBlock != 400 {
+		t.Errorf("measured from block %d, want 400", p.fromBlock)
+	}
+	if !strings.Contains(p.Label, "ETA unknown") {
+		t.Errorf("label %q, want an unknown ETA", p.Label)
+	}
+}
+
+func TestSub(t *testing.T) {
+	if got := sub(5, 3); got != 2 {
+		t.Errorf("sub(5, 3) = %d, want 2", got)
+	}
+	if got := sub(3, 5); got != 0 {
+		t.Errorf("sub(3, 5) = %d, want 0", got)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	ui "github.com/gizak/termui"
+)
+
+// level is the severity of a reading, e.g. whether the block rate is as
+// expected or far too low.
+type level int
+
+const (
+	levelGood level = iota
+	levelWarn
+	levelBad
+)
+
+// theme holds the colours used by the dashboard. Severity levels carry a
+// glyph next to their colour so that themes for colour blind users don't
+// rely on colour alone.
+type theme struct {
+	gasLimit    ui.Attribute
+	gasUsed     ui.Attribute
+	gasPercent  ui.Attribute
+	blockTime   ui.Attribute
+	gasPrice    ui.Attribute
+	previous    ui.Attribute // previous block bar of the gas comparison
+	title       ui.Attribute
+	popup       ui.Attribute
+	accent      string // markup colour of highlights such as the pulse
+	accentColor ui.Attribute
+
+	levels [3]ui.Attribute // colours by level
+	marks  [3]string       // markup colours by level
+	cues   [3]string       // non-colour cues by level, may be empty
+}
+
+var themes = map[string]theme{
+	"default": {
+		gasLimit:    ui.ColorCyan,
+		gasUsed:     ui.ColorRed,
+		gasPercent:  ui.ColorYellow,
+		blockTime:   ui.ColorMagenta,
+		gasPrice:    ui.ColorGreen,
+		previous:    ui.ColorBlue,
+		title:       ui.ColorWhite,
+		popup:       ui.ColorYellow,
+		accent:      "fg-cyan",
+		accentColor: ui.ColorCyan,
+		levels:      [3]ui.Attribute{ui.ColorGreen, ui.ColorYellow, ui.ColorRed},
+		marks:       [3]string{"fg-green", "fg-yellow", "fg-red"},
+	},
+	// colorblind avoids the red/green distinction by using blue and
+	// yellow hues of differing brightness, and adds glyphs to severities.
+	"colorblind": {
+		gasLimit:    ui.ColorBlue | ui.AttrBold,
+		gasUsed:     ui.ColorYellow,
+		gasPercent:  ui.ColorWhite,
+		blockTime:   ui.ColorCyan,
+		gasPrice:    ui.ColorMagenta,
+		previous:    ui.ColorWhite,
+		title:       ui.ColorWhite | ui.AttrBold,
+		popup:       ui.ColorWhite | ui.AttrBold,
+		accent:      "fg-white,fg-bold",
+		accentColor: ui.ColorWhite | ui.AttrBold,
+		levels:      [3]ui.Attribute{ui.ColorBlue | ui.AttrBold, ui.ColorYellow, ui.ColorMagenta | ui.AttrBold},
+		marks:       [3]string{"fg-blue,fg-bold", "fg-yellow", "fg-magenta,fg-bold"},
+		cues:        [3]string{"ok", "!", "!!"},
+	},
+}
+
+// lightThemes are the variants of the themes for terminals with a light
+// background, which avoid white, cyan and yellow text that is hard to read
+// on white.
+var lightThemes = map[string]theme{
+	"default": {
+		gasLimit:    ui.ColorBlue,
+		gasUsed:     ui.ColorRed,
+		gasPercent:  ui.ColorGreen,
+		blockTime:   ui.ColorMagenta,
+		gasPrice:    ui.ColorGreen,
+		previous:    ui.ColorBlue,
+		title:       ui.ColorBlack,
+		popup:       ui.ColorMagenta,
+		accent:      "fg-blue",
+		accentColor: ui.ColorBlue,
+		levels:      [3]ui.Attribute{ui.ColorGreen, ui.ColorMagenta, ui.ColorRed},
+		marks:       [3]string{"fg-green", "fg-magenta", "fg-red"},
+	},
+	"colorblind": {
+		gasLimit:    ui.ColorBlue | ui.AttrBold,
+		gasUsed:     ui.ColorMagenta,
+		gasPercent:  ui.ColorBlack,
+		blockTime:   ui.ColorBlue,
+		gasPrice:    ui.ColorMagenta,
+		previous:    ui.ColorBlack,
+		title:       ui.ColorBlack | ui.AttrBold,
+		popup:       ui.ColorBlack | ui.AttrBold,
+		accent:      "fg-black,fg-bold",
+		accentColor: ui.ColorBlack | ui.AttrBold,
+		levels:      [3]ui.Attribute{ui.ColorBlue | ui.AttrBold, ui.ColorMagenta, ui.ColorRed | ui.AttrBold},
+		marks:       [3]string{"fg-blue,fg-bold", "fg-magenta", "fg-red,fg-bold"},
+		cues:        [3]string{"ok", "!", "!!"},
+	},
+}
+
+// Terminal backgrounds the theme is chosen for.
+const (
+	backgroundAuto  = "auto"
+	backgroundDark  = "dark"
+	backgroundLight = "light"
+)
+
+// detectBackground guesses the terminal background from COLORFGBG, which
+// terminals such as rxvt and Konsole set to e.g. "15;0". Background colours 7
+// and 15 are light grey and white, anything unknown is taken as dark.
+func detectBackground() string {
+	parts := strings.Split(os.Getenv("COLORFGBG"), ";")
+	bg, err := strconv.Atoi(parts[len(parts)-1])
+	if err == nil && (bg == 7 || bg == 15) {
+		return backgroundLight
+	}
+	return backgroundDark
+}
+
+// th is the active theme, selected with the -theme and -background flags.
+var th = themes["default"]
+
+// setTheme activates the theme with the given name for the background, one
+// of dark, light or auto. It has to be called before the widgets are
+// created, since they take their colours from the theme and from termui's
+// ColorMap.
+func setTheme(name, background string) error {
+	t, ok := themes[name]
+	if !ok {
+		var names []string
+		for name := range themes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown theme %q (known: %v)", name, names)
+	}
+	if background == backgroundAuto {
+		background = detectBackground()
+	}
+	switch background {
+	case backgroundDark:
+	case backgroundLight:
+		t = lightThemes[name]
+		// termui draws texts and borders in white by default
+		ui.ColorMap["fg"] = ui.ColorBlack
+		ui.ColorMap["border.fg"] = ui.ColorBlack
+	default:
+		return fmt.Errorf("unknown background %q (known: auto, dark, light)", background)
+	}
+	th = t
+	return nil
+}
+
+// color returns the colour of the given level.
+func (t theme) color(l level) ui.Attribute { return t.levels[l] }
+
+// mark renders text in the markup colour of the given level, prefixed by
+// the level's cue if the theme has one.
+func (t theme) mark(l level, text string) string {
+	return t.paint(l, t.cue(l)+text)
+}
+
+// paint renders text in the markup colour of the given level without a cue,
+// for texts that don't rely on colour alone already.
+func (t theme) paint(l level, text string) string {
+	return fmt.Sprintf("[%s](%s)", text, t.marks[l])
+}
+
+// cue returns the non-colour cue of the level followed by a space, or the
+// empty string if the theme has none.
+func (t theme) cue(l level) string {
+	if t.cues[l] == "" {
+		return ""
+	}
+	return t.cues[l] + " "
+}
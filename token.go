@@ -0,0 +1,195 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	ui "github.com/gizak/termui"
+)
+
+var (
+	// transferTopic is the signature of Transfer(address,address,uint256).
+	transferTopic = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+	// decimalsSelector is the method id of decimals().
+	decimalsSelector = common.FromHex("0x313ce567")
+)
+
+// defaultDecimals is assumed for tokens that don't implement decimals().
+const defaultDecimals = 18
+
+// tokenBlock aggregates the transfers of a token within a single block.
+type tokenBlock struct {
+	number uint64
+	count  int
+	value  *big.Int
+}
+
+// tokenWatcher follows the Transfer events of an ERC-20 token and aggregates
+// them per block. It's written by watch and read by the UI goroutine.
+type tokenWatcher struct {
+	endpoint string
+	contract common.Address
+
+	mu         sync.Mutex
+	decimals   int
+	blocks     []*tokenBlock // the last historyLimit blocks with transfers, oldest first
+	transfers  int
+	totalValue *big.Int
+}
+
+func newTokenWatcher(endpoint string, contract common.Address) *tokenWatcher {
+	return &tokenWatcher{
+		endpoint:   endpoint,
+		contract:   contract,
+		decimals:   defaultDecimals,
+		totalValue: new(big.Int),
+	}
+}
+
+// watch subscribes to the Transfer events of the token until ctx is cancelled.
+func (w *tokenWatcher) watch(ctx context.Context, console *console) {
+	rpcClient, err := dialEndpoint(ctx, w.endpoint)
+	if err != nil {
+		console.alert(levelWarn, fmt.Sprint("Token: failed to attach: ", err))
+		return
+	}
+	client := ethclient.NewClient(rpcClient)
+	decimals, err := tokenDecimals(ctx, client, w.contract)
+	if err != nil {
+		console.writef("Token: no standard decimals() (%v), assuming %d", err, defaultDecimals)
+		decimals = defaultDecimals
+	}
+	w.mu.Lock()
+	w.decimals = decimals
+	w.mu.Unlock()
+
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{w.contract},
+		Topics:    [][]common.Hash{{transferTopic}},
+	}
+	logs := make(chan types.Log)
+	sub, err := client.SubscribeFilterLogs(ctx, query, logs)
+	if err != nil {
+		console.alert(levelWarn, fmt.Sprint("Token: failed to subscribe to transfers: ", err))
+		return
+	}
+	defer sub.Unsubscribe()
+	console.writef("OK: Watching transfers of token %s (%d decimals)", w.contract.Hex(), decimals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-sub.Err():
+			console.alert(levelWarn, fmt.Sprint("Token: transfer subscription dropped: ", err))
+			return
+		case log := <-logs:
+			if !log.Removed {
+				w.transferred(log)
+			}
+		}
+	}
+}
+
+// tokenDecimals calls decimals() on the token contract.
+func tokenDecimals(ctx context.Context, client *ethclient.Client, contract common.Address) (int, error) {
+	out, err := client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: decimalsSelector}, nil)
+	if err != nil {
+		return 0, err
+	}
+	if len(out) < 32 {
+		return 0, fmt.Errorf("unexpected result 0x%x", out)
+	}
+	decimals := new(big.Int).SetBytes(out[:32])
+	if !decimals.IsInt64() || decimals.Int64() > 77 {
+		return 0, fmt.Errorf("implausible decimals %v", decimals)
+	}
+	return int(decimals.Int64()), nil
+}
+
+// transferred adds a Transfer log to the aggregate of its block. The value
+// is the unindexed data word of the event.
+func (w *tokenWatcher) transferred(log types.Log) {
+	value := new(big.Int)
+	if len(log.Data) >= 32 {
+		value.SetBytes(log.Data[:32])
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var block *tokenBlock
+	for i := len(w.blocks) - 1; i >= 0; i-- {
+		if w.blocks[i].number == log.BlockNumber {
+			block = w.blocks[i]
+			break
+		}
+	}
+	if block == nil {
+		block = &tokenBlock{number: log.BlockNumber, value: new(big.Int)}
+		w.blocks = append(w.blocks[evictions(len(w.blocks)):], block)
+	}
+	block.count++
+	block.value.Add(block.value, value)
+
+	w.transfers++
+	w.totalValue.Add(w.totalValue, value)
+}
+
+// tokenUnit returns the raw value of one whole token.
+func tokenUnit(decimals int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+}
+
+// tokenAmount converts a raw token value into whole token units.
+func tokenAmount(value *big.Int, decimals int) float64 {
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(value), new(big.Float).SetInt(tokenUnit(decimals))).Float64()
+	return f
+}
+
+// update plots the transfer count and volume per block and shows the
+// running totals in the titles.
+func (w *tokenWatcher) update(sp *ui.Sparklines) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	counts := make([]int, len(w.blocks))
+	volumes := make([]int, len(w.blocks))
+	for i, block := range w.blocks {
+		counts[i] = block.count
+		volumes[i] = sampleValue(block.value, tokenUnit(w.decimals))
+	}
+	sp.Lines[0].Data = counts
+	sp.Lines[0].Title = fmt.Sprintf("Transfers per block (%d total)", w.transfers)
+	sp.Lines[1].Data = volumes
+	sp.Lines[1].Title = fmt.Sprintf("Volume per block (%s total)", formatFloat(tokenAmount(w.totalValue, w.decimals)))
+}
+
+func newTokenGraph() *ui.Sparklines {
+	count := ui.Sparkline{}
+	count.Height = 3
+	count.Title = "enable with -token"
+	count.LineColor = th.gasLimit
+	count.TitleColor = th.title
+
+	volume := ui.Sparkline{}
+	volume.Height = 3
+	volume.LineColor = th.gasUsed
+	volume.TitleColor = th.title
+
+	sp := ui.NewSparklines(count, volume)
+	sp.Height = 10
+	sp.BorderLabel = "Token transfers"
+
+	return sp
+}
@@ -0,0 +1,102 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	ui "github.com/gizak/termui"
+)
+
+// topTxCount is the number of transactions listed in the top transactions
+// panel.
+const topTxCount = 5
+
+func newTopTxList() *ui.List {
+	list := ui.NewList()
+	list.Height = topTxCount + 2
+	list.BorderLabel = "Top gas consumers"
+	list.Items = []string{"enable with -receipts"}
+
+	return list
+}
+
+// shortHex abbreviates a hex string to its first and last four digits.
+func shortHex(s string) string {
+	if len(s) <= 12 {
+		return s
+	}
+	return s[:6] + ".." + s[len(s)-4:]
+}
+
+// updateTopTxList lists the transactions of the block that used the most
+// gas, together with their share of the block's gas used.
+func updateTopTxList(list *ui.List, data *blockData) {
+	if len(data.receipts) != len(data.block.Transactions) {
+		return
+	}
+	if len(data.receipts) == 0 {
+		list.Items = []string{"no transactions"}
+		return
+	}
+	idx := make([]int, len(data.receipts))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(a, b int) bool {
+		return data.receipts[idx[a]].GasUsed > data.receipts[idx[b]].GasUsed
+	})
+	if len(idx) > topTxCount {
+		idx = idx[:topTxCount]
+	}
+	items := make([]string, len(idx))
+	for i, n := range idx {
+		var (
+			tx      = data.block.Transactions[n]
+			gasUsed = uint64(data.receipts[n].GasUsed)
+			to      = "create"
+			share   float64
+		)
+		if tx.To != nil {
+			to = shortHex(tx.To.Hex())
+		}
+		if data.block.GasUsed > 0 {
+			share = 100 * float64(gasUsed) / float64(data.block.GasUsed)
+		}
+		items[i] = fmt.Sprintf("%s -> %-14s %7s (%s%%)", shortHex(tx.Hash.Hex()), to, formatHuman(gasUsed), formatFloat(share))
+	}
+	list.Items = items
+}
+
+// largestTxShare returns the percentage of the block's gas used by its
+// single largest transaction. Values close to 100 indicate blocks dominated
+// by a whale transaction or a bundle. ok is false for empty blocks.
+func largestTxShare(data *blockData) (share float64, ok bool) {
+	if len(data.receipts) == 0 || len(data.receipts) != len(data.block.Transactions) || data.block.GasUsed == 0 {
+		return 0, false
+	}
+	var largest uint64
+	for _, receipt := range data.receipts {
+		if gasUsed := uint64(receipt.GasUsed); gasUsed > largest {
+			largest = gasUsed
+		}
+	}
+	return 100 * float64(largest) / float64(data.block.GasUsed), true
+}
+
+func newTxShareGraph() *ui.Sparklines {
+	spark := ui.Sparkline{}
+	spark.Height = 5
+	spark.Title = "enable with -receipts"
+	spark.LineColor = th.accentColor
+	spark.TitleColor = th.title
+
+	sp := ui.NewSparklines(spark)
+	sp.Height = 8
+	sp.BorderLabel = "Largest tx share of block gas"
+
+	return sp
+}
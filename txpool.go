@@ -0,0 +1,139 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ui "github.com/gizak/termui"
+)
+
+// txPoolInterval is the time between two requests for the pool status. It's
+// set with -txpool-interval.
+var txPoolInterval = 2 * time.Second
+
+// defaultPoolSlots is the capacity of geth's transaction pool with its
+// default global slots and queue, 5120 pending and 1024 queued.
+const defaultPoolSlots = 6144
+
+// txPoolStatus is the response of txpool_status.
+type txPoolStatus struct {
+	Pending hexutil.Uint64 `json:"pending"`
+	Queued  hexutil.Uint64 `json:"queued"`
+}
+
+// txPoolWatcher polls the transaction pool of the node independent of the
+// head subscription. It's written by watch and read by the UI goroutine.
+type txPoolWatcher struct {
+	endpoint string
+	slots    int // capacity of the pool the usage is relative to
+
+	mu      sync.Mutex
+	pending []int
+	queued  []int
+	polled  bool // whether a status was received
+}
+
+func newTxPoolWatcher(endpoint string, slots int) *txPoolWatcher {
+	return &txPoolWatcher{endpoint: endpoint, slots: slots}
+}
+
+// watch polls txpool_status until ctx is cancelled. Nodes without the
+// txpool API are given up on after the first failure.
+func (w *txPoolWatcher) watch(ctx context.Context, console *console) {
+	rpcClient, err := dialEndpoint(ctx, w.endpoint)
+	if err != nil {
+		console.alert(levelWarn, fmt.Sprint("Tx pool: failed to attach: ", err))
+		return
+	}
+	defer rpcClient.Close()
+
+	ticker := time.NewTicker(txPoolInterval)
+	defer ticker.Stop()
+
+	for {
+		var status txPoolStatus
+		if err := rpcClient.CallContext(ctx, &status, "txpool_status"); err != nil {
+			if ctx.Err() == nil {
+				console.writeln("Tx pool: txpool_status unavailable, stopped polling: ", err)
+			}
+			return
+		}
+		w.mu.Lock()
+		w.pending = pushSample(w.pending, int(status.Pending))
+		w.queued = pushSample(w.queued, int(status.Queued))
+		w.polled = true
+		w.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// update renders the pool status into the graph and the usage gauge. It
+// reports false until the first status was received.
+func (w *txPoolWatcher) update(sp *ui.Sparklines, gauge *ui.Gauge) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.polled {
+		return false
+	}
+	pending, queued := w.pending[len(w.pending)-1], w.queued[len(w.queued)-1]
+	sp.Lines[0].Data = w.pending
+	sp.Lines[0].Title = fmt.Sprintf("Pending: %d", pending)
+	sp.Lines[1].Data = w.queued
+	sp.Lines[1].Title = fmt.Sprintf("Queued: %d", queued)
+
+	usage := (pending + queued) * 100 / w.slots
+	if usage > 100 {
+		usage = 100
+	}
+	gauge.Percent = usage
+	gauge.Label = fmt.Sprintf("{{percent}}%% of %d slots", w.slots)
+	gauge.BarColor = th.color(levelGood)
+	switch {
+	case usage >= 90:
+		gauge.BarColor = th.color(levelBad)
+	case usage >= 70:
+		gauge.BarColor = th.color(levelWarn)
+	}
+	return true
+}
+
+func newTxPoolGraph() *ui.Sparklines {
+	pending := ui.Sparkline{}
+	pending.Height = 3
+	pending.Title = "enable with -txpool"
+	pending.LineColor = th.gasUsed
+	pending.TitleColor = th.title
+
+	queued := ui.Sparkline{}
+	queued.Height = 3
+	queued.LineColor = th.gasLimit
+	queued.TitleColor = th.title
+
+	sp := ui.NewSparklines(pending, queued)
+	sp.Height = 10
+	sp.BorderLabel = "Transaction pool"
+
+	return sp
+}
+
+func newTxPoolGauge() *ui.Gauge {
+	gauge := ui.NewGauge()
+	gauge.Height = 3
+	gauge.BorderLabel = "Pool usage"
+	gauge.PercentColor = th.title
+
+	return gauge
+}
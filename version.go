@@ -0,0 +1,26 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Build information, injected at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// buildInfo describes the build, e.g. for the -version flag and bug reports.
+func buildInfo() string {
+	return fmt.Sprintf("moneth %s (commit %s, built %s, %s, go-ethereum %s)", version, commit, date, runtime.Version(), params.Version)
+}
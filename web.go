@@ -0,0 +1,126 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// webRefresh is the interval the web page reloads itself at.
+	webRefresh = 5
+	// svgWidth and svgHeight are the dimensions of the web sparklines.
+	svgWidth  = 400
+	svgHeight = 60
+)
+
+var webPage = template.Must(template.New("web").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>moneth</title>
+<style>
+body { font-family: monospace; background: #111; color: #ddd; margin: 2em; }
+svg { background: #1b1b1b; display: block; margin-bottom: 1em; }
+polyline { fill: none; stroke: #4caf50; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h2>{{.Head}}</h2>
+<p>{{.Health}}</p>
+{{range .Series}}<div>{{.Name}}: {{.Last}}</div>
+<svg width="{{$.Width}}" height="{{$.Height}}"><polyline points="{{.Points}}"/></svg>
+{{end}}<pre>{{.Report}}</pre>
+</body>
+</html>
+`))
+
+// webSeries is a graph series as rendered on the web page.
+type webSeries struct {
+	Name   string
+	Last   int
+	Points string // SVG polyline points
+}
+
+// svgPoints scales the series into polyline points of a width by height
+// box, with the maximum of the series at the top.
+func svgPoints(data []int, width, height int) string {
+	max := 1
+	for _, v := range data {
+		if v > max {
+			max = v
+		}
+	}
+	step := float64(width)
+	if len(data) > 1 {
+		step = float64(width) / float64(len(data)-1)
+	}
+	points := make([]string, len(data))
+	for i, v := range data {
+		y := float64(height) - float64(v)*float64(height)/float64(max)
+		points[i] = fmt.Sprintf("%.1f,%.1f", float64(i)*step, y)
+	}
+	return strings.Join(points, " ")
+}
+
+// webHandler serves a self refreshing HTML mirror of the dashboard built
+// from the session.
+type webHandler struct {
+	sess *session
+}
+
+func (h *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	head, health := "waiting for first head...", ""
+	if header := h.sess.head(); header != nil {
+		head = "Block " + formatBlockNumber(header.Number) + ": " + gasReadout(header)
+	}
+	if last, avg := h.sess.arrivals(); !last.IsZero() {
+		health = fmt.Sprintf("last head %v ago (avg interval %v)", time.Since(last).Round(time.Second), avg.Round(time.Second))
+	}
+	var series []webSeries
+	for _, s := range h.sess.allSeries() {
+		if len(s.data) == 0 {
+			continue
+		}
+		series = append(series, webSeries{
+			Name:   s.name,
+			Last:   s.data[len(s.data)-1],
+			Points: svgPoints(s.data, svgWidth, svgHeight),
+		})
+	}
+	var report bytes.Buffer
+	h.sess.report(&report)
+
+	err := webPage.Execute(w, map[string]interface{}{
+		"Refresh": webRefresh,
+		"Head":    head,
+		"Health":  health,
+		"Series":  series,
+		"Width":   svgWidth,
+		"Height":  svgHeight,
+		"Report":  report.String(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveWeb serves the web mirror on the listener until it's closed.
+func serveWeb(l net.Listener, sess *session, console *console) {
+	if err := http.Serve(l, &webHandler{sess: sess}); err != nil {
+		console.writeln("Web dashboard stopped: ", err)
+	}
+}
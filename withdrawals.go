@@ -0,0 +1,116 @@
+// Copyright 2016 Zack Guo <zack.y.guo@gmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT license that can
+// be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	ui "github.com/gizak/termui"
+)
+
+// topRecipientCount is the number of recipients listed in the withdrawals
+// panel.
+const topRecipientCount = 5
+
+// withdrawalTracker sums the withdrawals of the last historyLimit fetched
+// blocks per recipient. It's only accessed from run.
+type withdrawalTracker struct {
+	names  map[common.Address]string // optional names of known recipients
+	blocks [][]*rpcWithdrawal        // withdrawals per block, oldest first
+}
+
+func newWithdrawalTracker(names map[common.Address]string) *withdrawalTracker {
+	return &withdrawalTracker{names: names}
+}
+
+// loadRecipientNames reads a JSON object mapping recipient addresses to
+// names, e.g. {"0xabc...": "pool A"}.
+func loadRecipientNames(path string) (map[common.Address]string, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(blob, &raw); err != nil {
+		return nil, fmt.Errorf("invalid recipient names %s: %v", path, err)
+	}
+	names := make(map[common.Address]string, len(raw))
+	for addr, name := range raw {
+		if !common.IsHexAddress(addr) {
+			return nil, fmt.Errorf("invalid recipient names %s: invalid address %q", path, addr)
+		}
+		names[common.HexToAddress(addr)] = name
+	}
+	return names, nil
+}
+
+// add accounts the withdrawals of a fetched block. Pre-Shanghai blocks have
+// none and only move the window.
+func (t *withdrawalTracker) add(block *rpcBlock) {
+	t.blocks = append(t.blocks[evictions(len(t.blocks)):], block.Withdrawals)
+}
+
+// recipient is the summed withdrawals of a single address.
+type recipient struct {
+	address common.Address
+	amount  uint64 // in gwei
+	count   int
+}
+
+// top returns the n recipients that received the most within the window.
+func (t *withdrawalTracker) top(n int) []recipient {
+	sums := make(map[common.Address]*recipient)
+	for _, withdrawals := range t.blocks {
+		for _, w := range withdrawals {
+			r := sums[w.Address]
+			if r == nil {
+				r = &recipient{address: w.Address}
+				sums[w.Address] = r
+			}
+			r.amount += uint64(w.Amount)
+			r.count++
+		}
+	}
+	all := make([]recipient, 0, len(sums))
+	for _, r := range sums {
+		all = append(all, *r)
+	}
+	sort.Slice(all, func(a, b int) bool { return all[a].amount > all[b].amount })
+	if len(all) > n {
+		all = all[:n]
+	}
+	return all
+}
+
+// update lists the top recipients with their summed amounts in ETH.
+func (t *withdrawalTracker) update(list *ui.List) {
+	top := t.top(topRecipientCount)
+	if len(top) == 0 {
+		list.Items = []string{fmt.Sprintf("no withdrawals in the last %d blocks", len(t.blocks))}
+		return
+	}
+	items := make([]string, len(top))
+	for i, r := range top {
+		name := shortHex(r.address.Hex())
+		if known, ok := t.names[r.address]; ok {
+			name = known
+		}
+		items[i] = fmt.Sprintf("%-16s %10s ETH (%d withdrawals)", name, formatFloat(float64(r.amount)/1e9), r.count)
+	}
+	list.Items = items
+}
+
+func newWithdrawalsList() *ui.List {
+	list := ui.NewList()
+	list.Height = topRecipientCount + 2
+	list.BorderLabel = "Top withdrawal recipients"
+	list.Items = []string{"enable with -fetch"}
+
+	return list
+}